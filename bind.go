@@ -0,0 +1,250 @@
+package pi
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrBinding is the message of the BindingError.
+	ErrBinding = fmt.Errorf("binding failed")
+
+	// ErrBindTarget is the error when Bind is not given a pointer to a struct.
+	ErrBindTarget = fmt.Errorf("bind target must be a pointer to a struct")
+
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// BindingError is the 400 HTTPError returned by Bind when values cannot be converted to the type of their field.
+// It is written like a ValidationError, listing every field that could not be bound.
+type BindingError struct {
+	Fields    []FieldError
+	xml       bool
+	requestID string
+}
+
+func (error *BindingError) Error() string {
+	return formatFieldErrors(error.StatusCode(), ErrBinding.Error(), error.Fields, error.xml, error.requestID)
+}
+
+func (error *BindingError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (error *BindingError) ContentType() string {
+	if error.xml {
+		return "application/xml; charset=UTF-8"
+	}
+	return "application/json; charset=UTF-8"
+}
+
+func (error *BindingError) withRequestID(requestID string) HTTPError {
+	withRequestID := *error
+	withRequestID.requestID = requestID
+	return &withRequestID
+}
+
+// Bind fills the fields of the struct pointed by object from the request, according to their struct tags:
+//
+//		path:"id"			the route variable, see GetRouteVariable
+//		query:"page"		the URL parameter, see GetURLParam
+//		header:"X-Tenant"	the request header
+//		body:""				the body, decoded according to the Content-Type, see GetDefaultObject,
+//							left untouched when the request has no body or no Content-Type, as most GET requests
+//		default:"1"			the value used when the route variable, URL parameter or header is missing
+//
+// The values are converted to the type of the field: strings, booleans, integers, floats, time.Duration,
+// types implementing encoding.TextUnmarshaler such as time.Time (RFC 3339), pointers and slices of these types,
+// and []byte, receiving the raw value.
+// The conversion errors of every field are returned together as a 400 *BindingError, otherwise the object
+// is validated (see Validate) and a 422 *ValidationError is returned if it is invalid.
+// A 415 HTTPError is returned if the body has a Content-Type without Codec.
+// For example:
+//		type GetUsersRequest struct {
+//			TeamID int    `path:"teamId"`
+//			Page   int    `query:"page" default:"1" validate:"min=1"`
+//			Tenant string `header:"X-Tenant" validate:"required"`
+//		}
+//
+//		func GetUsers(c *pi.RequestContext) error {
+//			request := &GetUsersRequest{}
+//			if err := c.Bind(request); err != nil {
+//				return err
+//			}
+//			// Do something with the request...
+//			return nil
+//		}
+//
+func (c *RequestContext) Bind(object interface{}) error {
+	value := reflect.ValueOf(object)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return ErrBindTarget
+	}
+	var fields []FieldError
+	tagName := "json"
+	if err := c.bindStruct(value.Elem(), &fields, &tagName); err != nil {
+		return err
+	}
+	if len(fields) != 0 {
+		return &BindingError{Fields: fields, xml: tagName == "xml"}
+	}
+	return validate(object, tagName, tagName == "xml")
+}
+
+// hasBody checks if the request has a Content-Type and a body which may not be empty.
+// A body of unknown length, sent in chunks, is considered not empty.
+func (c *RequestContext) hasBody() bool {
+	if c.GetContentType() == "" {
+		return false
+	}
+	if c.bodyRead {
+		return len(c.rawBody) != 0
+	}
+	return c.R.Body != nil && c.R.Body != http.NoBody && c.R.ContentLength != 0
+}
+
+// bindStruct binds the fields of a struct, recursing into the embedded structs.
+func (c *RequestContext) bindStruct(value reflect.Value, fields *[]FieldError, tagName *string) error {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		structField := valueType.Field(i)
+		if structField.PkgPath != "" {
+			continue
+		}
+		field := value.Field(i)
+		if _, ok := structField.Tag.Lookup("body"); ok {
+			if !c.hasBody() {
+				continue
+			}
+			bodyTagName, err := c.decodeDefaultObject(field.Addr().Interface())
+			if err != nil {
+				if err == ErrContentTypeNotSupported {
+					return NewError(http.StatusUnsupportedMediaType, err)
+				}
+				if _, ok := err.(HTTPError); ok {
+					return err
+				}
+				*fields = append(*fields, FieldError{Field: "body", Message: err.Error()})
+				continue
+			}
+			*tagName = bodyTagName
+			continue
+		}
+
+		var name string
+		var values []string
+		found := false
+		if name = structField.Tag.Get("path"); name != "" {
+			values = []string{c.GetRouteVariable(name)}
+			found = values[0] != ""
+		} else if name = structField.Tag.Get("query"); name != "" {
+			values, found = c.R.URL.Query()[name]
+		} else if name = structField.Tag.Get("header"); name != "" {
+			values, found = c.R.Header[http.CanonicalHeaderKey(name)]
+		} else {
+			if structField.Anonymous && field.Kind() == reflect.Struct {
+				if err := c.bindStruct(field, fields, tagName); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !found {
+			defaultValue, ok := structField.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			values = []string{defaultValue}
+		}
+		if err := setValues(field, values); err != nil {
+			*fields = append(*fields, FieldError{Field: name, Message: err.Error()})
+		}
+	}
+	return nil
+}
+
+// setValues converts the values to the type of the field and sets them.
+// Slices receive every values, other types the first one.
+func setValues(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && field.Type().Elem().Kind() != reflect.Uint8 && !field.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+// setValue converts the value to the type of the field and sets it.
+func setValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		pointer := reflect.New(field.Type().Elem())
+		if err := setValue(pointer.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(pointer)
+		return nil
+	}
+	if field.CanAddr() && field.Addr().Type().Implements(textUnmarshalerType) {
+		if err := field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("is invalid: %s", err)
+		}
+		return nil
+	}
+	if field.Type() == durationType {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("must be a duration")
+		}
+		field.SetInt(int64(duration))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("has an unsupported type %s", field.Type())
+		}
+		field.SetBytes([]byte(value))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be a boolean")
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a positive integer")
+		}
+		field.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("has an unsupported type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package pi
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindBody struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type bindRequest struct {
+	ID      int           `path:"id"`
+	Page    int           `query:"page" default:"1" validate:"min=1"`
+	Tags    []string      `query:"tag"`
+	Active  *bool         `query:"active"`
+	Timeout time.Duration `query:"timeout" default:"1s"`
+	Since   time.Time     `query:"since"`
+	Tenant  string        `header:"X-Tenant" validate:"required"`
+	Body    bindBody      `body:"" json:"body"`
+}
+
+func TestBind(t *testing.T) {
+	p := New()
+	p.Router("/users/{id}").Post(func(c *RequestContext) error {
+		request := &bindRequest{}
+		if err := c.Bind(request); err != nil {
+			return err
+		}
+		return c.WriteString(fmt.Sprintf("%d %d %v %v %s %d %s %s", request.ID, request.Page, request.Tags, *request.Active,
+			request.Timeout, request.Since.Year(), request.Tenant, request.Body.Name))
+	})
+	p.Construct()
+
+	r := httptest.NewRequest("POST", "/users/42?tag=a&tag=b&active=true&since=2020-01-02T15:04:05Z", strings.NewReader(`{"name": "pi"}`))
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	r.Header.Set("X-Tenant", "gocarina")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Body.String() != "42 1 [a b] true 1s 2020 gocarina pi" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/users/pi?page=one&active=maybe", strings.NewReader(`{"name": "pi"}`))
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	expected := `{"errorCode": 400, "errorMessage": "binding failed", "fields": [{"field":"id","message":"must be an integer"},{"field":"page","message":"must be an integer"},{"field":"active","message":"must be a boolean"}]}`
+	if w.Code != 400 || w.Body.String() != expected {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/users/42?page=0", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	expected = `{"errorCode": 422, "errorMessage": "validation failed", "fields": [{"field":"page","message":"must be greater or equal to 1"},{"field":"X-Tenant","message":"is required"},{"field":"body.name","message":"is required"}]}`
+	if w.Code != 422 || w.Body.String() != expected {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
+
+type bindListRequest struct {
+	Page   int       `query:"page" default:"1"`
+	Filter *bindBody `body:""`
+}
+
+func TestBindWithoutBody(t *testing.T) {
+	p := New()
+	handler := func(c *RequestContext) error {
+		request := &bindListRequest{}
+		if err := c.Bind(request); err != nil {
+			return err
+		}
+		return c.WriteString(fmt.Sprintf("%d %v", request.Page, request.Filter != nil))
+	}
+	p.Router("/users").Get(handler).Delete(handler).Post(handler)
+	p.Construct()
+
+	tests := []struct {
+		method      string
+		contentType string
+		body        string
+		code        int
+		expected    string
+	}{
+		{"GET", "", "", 200, "2 false"},
+		{"DELETE", "", "", 200, "2 false"},
+		{"POST", ContentTypeJSON, "", 200, "2 false"},
+		{"POST", ContentTypeJSON, `{"name": "pi"}`, 200, "2 true"},
+		{"POST", "text/csv", "name\npi", 415, `{"errorCode": 415, "errorMessage": "format not supported"}`},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/users?page=2", strings.NewReader(test.body))
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != test.code || w.Body.String() != test.expected {
+			t.Errorf("%s %q: expected %d %s, got %d %s", test.method, test.body, test.code, test.expected, w.Code, w.Body.String())
+		}
+	}
+}
+
+type bindBytesRequest struct {
+	Data      []byte `query:"data"`
+	Signature []byte `header:"X-Signature"`
+}
+
+func TestBindBytes(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?data=pi", nil)
+	r.Header.Set("X-Signature", "abc")
+	request := &bindBytesRequest{}
+	if err := newRequestContext(httptest.NewRecorder(), r, "/").Bind(request); err != nil {
+		t.Fatal(err)
+	}
+	if string(request.Data) != "pi" || string(request.Signature) != "abc" {
+		t.Errorf("unexpected bytes %q %q", request.Data, request.Signature)
+	}
+}
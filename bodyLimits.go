@@ -0,0 +1,90 @@
+package pi
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var (
+	// DefaultMultipartMaxMemory is the default number of bytes of a multipart form kept in memory,
+	// the rest of the files being stored in temporary files.
+	DefaultMultipartMaxMemory int64 = 32 << 20
+
+	// ErrBodyTooLarge is the error when the request body exceeds the maximum body size.
+	ErrBodyTooLarge = fmt.Errorf("body too large")
+)
+
+// SetMaxBodySize sets the maximum size of the request bodies, for every route not setting its own
+// maximum size with Route.MaxBodySize. Reading a larger body fails with a 413 HTTPError.
+// The size is not limited if it is lower or equal to 0, which is the default.
+func (p *Pi) SetMaxBodySize(size int64) {
+	p.maxBodySize = size
+}
+
+// SetMultipartLimits sets how many bytes of a multipart form are kept in memory, and how many bytes
+// may be stored in temporary files when parsing the form with GetFileHeaders or GetMultipartObject.
+// By default, DefaultMultipartMaxMemory bytes are kept in memory and the size on disk is only limited
+// by the maximum body size.
+func (p *Pi) SetMultipartLimits(maxMemory, maxDiskSize int64) {
+	p.multipartMaxMemory = maxMemory
+	p.multipartMaxDiskSize = maxDiskSize
+}
+
+// MaxBodySize sets the maximum size of the request bodies of the route and its child routes,
+// overriding the size set with Pi.SetMaxBodySize. A negative size removes the limit.
+func (r *Route) MaxBodySize(size int64) *Route {
+	r.maxBodySize = size
+	return r
+}
+
+// routeMaxBodySize returns the maximum body size of the deepest route having one, or the one of the Pi.
+func (p *Pi) routeMaxBodySize(parentRoutes []*Route) int64 {
+	for i := len(parentRoutes) - 1; i >= 0; i-- {
+		if parentRoutes[i].maxBodySize != 0 {
+			return parentRoutes[i].maxBodySize
+		}
+	}
+	return p.maxBodySize
+}
+
+// limitBody limits the size of the request body.
+func limitBody(w http.ResponseWriter, r *http.Request, maxBodySize int64) {
+	if maxBodySize > 0 && r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	}
+}
+
+// bodyError converts the errors raised when a body is too large to a 413 HTTPError.
+func bodyError(err error) error {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) || errors.Is(err, ErrBodyTooLarge) {
+		return NewError(http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
+	}
+	if errors.Is(err, ErrDecompressedBodyTooLarge) {
+		return NewError(http.StatusRequestEntityTooLarge, ErrDecompressedBodyTooLarge)
+	}
+	if errors.Is(err, ErrPartTooLarge) {
+		return NewError(http.StatusRequestEntityTooLarge, ErrPartTooLarge)
+	}
+	return err
+}
+
+// parseMultipartForm parses the multipart form of the request using the limits of the Pi.
+func (c *RequestContext) parseMultipartForm() error {
+	maxMemory, maxDiskSize := DefaultMultipartMaxMemory, int64(0)
+	if c.pi != nil {
+		if c.pi.multipartMaxMemory > 0 {
+			maxMemory = c.pi.multipartMaxMemory
+		}
+		maxDiskSize = c.pi.multipartMaxDiskSize
+	}
+	if c.R.MultipartForm == nil && maxDiskSize > 0 && c.R.Body != nil {
+		c.R.Body = &closers{
+			Reader:  &maxSizeReader{reader: c.R.Body, remaining: maxMemory + maxDiskSize, err: ErrBodyTooLarge},
+			closers: []io.Closer{c.R.Body},
+		}
+	}
+	return bodyError(c.R.ParseMultipartForm(maxMemory))
+}
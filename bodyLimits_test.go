@@ -0,0 +1,74 @@
+package pi
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func echoBody(c *RequestContext) error {
+	rawBody, err := c.GetRawBody()
+	if err != nil {
+		return err
+	}
+	return c.WriteString(string(rawBody))
+}
+
+func TestMaxBodySize(t *testing.T) {
+	p := New()
+	p.SetMaxBodySize(10)
+	p.Router("/",
+		p.Route("/large").Post(echoBody).MaxBodySize(100),
+		p.Route("/unlimited").Post(echoBody).MaxBodySize(-1),
+	).Post(echoBody)
+	p.Construct()
+
+	tests := []struct {
+		path       string
+		size       int
+		statusCode int
+	}{
+		{"/", 10, 200},
+		{"/", 11, 413},
+		{"/large", 100, 200},
+		{"/large", 101, 413},
+		{"/unlimited", 1000, 200},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("POST", test.path, strings.NewReader(strings.Repeat("a", test.size))))
+		if w.Code != test.statusCode {
+			t.Errorf("expected %d for %d bytes on %s, got %d", test.statusCode, test.size, test.path, w.Code)
+		}
+	}
+}
+
+func TestMultipartLimits(t *testing.T) {
+	p := New()
+	p.SetMultipartLimits(100, 1000)
+	p.Router("/").Post(func(c *RequestContext) error {
+		files, err := c.GetFileHeaders("file")
+		if err != nil {
+			return err
+		}
+		return c.WriteString(files[0].Filename)
+	})
+	p.Construct()
+
+	for size, statusCode := range map[int]int{500: 200, 5000: 413} {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, _ := writer.CreateFormFile("file", "pi.txt")
+		part.Write([]byte(strings.Repeat("a", size)))
+		writer.Close()
+		r := httptest.NewRequest("POST", "/", body)
+		r.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != statusCode {
+			t.Errorf("expected %d for a %d bytes file, got %d %s", statusCode, size, w.Code, w.Body.String())
+		}
+	}
+}
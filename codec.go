@@ -0,0 +1,173 @@
+package pi
+
+import (
+	"encoding"
+	"fmt"
+	"strings"
+)
+
+// Codec decodes the request bodies and encodes the responses of a MIME type.
+// Codecs are registered on the Pi with RegisterCodec, and are picked by GetDefaultObject
+// according to the Content-Type of the request and by WriteDefault according to its Accept header.
+// A Codec that only decodes, or only encodes, returns ErrContentTypeNotSupported from the other method.
+// If the Codec names the fields of the decoded objects with a struct tag other than json, it
+// implements StructTagger so the fields of the ValidationError are named accordingly.
+type Codec interface {
+	// Decode decodes the body of the request into the object. The object is validated afterwards.
+	Decode(c *RequestContext, object interface{}) error
+	// Encode writes the object to the response, setting the Content-Type header.
+	Encode(c *RequestContext, object interface{}) error
+}
+
+// StructTagger is implemented by the Codecs naming the fields with a struct tag other than json.
+type StructTagger interface {
+	StructTag() string
+}
+
+// codecs is a registry of Codecs by MIME type, keeping the order of registration.
+type codecs struct {
+	mimeTypes []string
+	byType    map[string]Codec
+}
+
+// newDefaultCodecs returns the registry of the Codecs supported by default.
+func newDefaultCodecs() *codecs {
+	registry := &codecs{byType: make(map[string]Codec)}
+	registry.register(ContentTypeJSON, jsonCodec{})
+	registry.register(ContentTypeXML, xmlCodec{})
+	registry.register(ContentTypeText, textCodec{})
+	registry.register(ContentTypeClassicForm, formCodec{})
+	registry.register(ContentTypeMultipart, multipartCodec{})
+	return registry
+}
+
+// defaultCodecs is the registry used by the RequestContexts not created by a Pi.
+var defaultCodecs = newDefaultCodecs()
+
+// register registers the Codec, replacing the one already registered for the MIME type.
+func (registry *codecs) register(mimeType string, codec Codec) {
+	mimeType = normalizeMediaType(mimeType)
+	if _, ok := registry.byType[mimeType]; !ok {
+		registry.mimeTypes = append(registry.mimeTypes, mimeType)
+	}
+	registry.byType[mimeType] = codec
+}
+
+// get returns the Codec registered for the media type of the Content-Type, or nil.
+func (registry *codecs) get(contentType string) Codec {
+	return registry.byType[normalizeMediaType(contentType)]
+}
+
+// normalizeMediaType returns the lower case media type of a Content-Type, without its parameters.
+func normalizeMediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+// RegisterCodec registers the Codec of a MIME type, such as "application/msgpack", replacing the
+// Codec already registered for it. The JSON, XML, text, form and multipart Codecs are registered by default.
+// For example:
+//		p := pi.New()
+//		p.RegisterCodec("application/x-yaml", YAMLCodec{})
+//
+func (p *Pi) RegisterCodec(mimeType string, codec Codec) {
+	p.codecs.register(mimeType, codec)
+}
+
+// codecs returns the Codecs registered on the Pi.
+func (c *RequestContext) codecs() *codecs {
+	if c.pi == nil {
+		return defaultCodecs
+	}
+	return c.pi.codecs
+}
+
+// structTag returns the struct tag naming the fields of the objects decoded by the Codec.
+func structTag(codec Codec) string {
+	if tagger, ok := codec.(StructTagger); ok {
+		return tagger.StructTag()
+	}
+	return "json"
+}
+
+// jsonCodec is the Codec of application/json, see GetJSONObject and WriteJSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(c *RequestContext, object interface{}) error {
+	return c.decodeJSONObject(object)
+}
+
+func (jsonCodec) Encode(c *RequestContext, object interface{}) error {
+	return c.WriteJSON(object)
+}
+
+// xmlCodec is the Codec of application/xml, see GetXMLObject and WriteXML.
+type xmlCodec struct{}
+
+func (xmlCodec) Decode(c *RequestContext, object interface{}) error {
+	return c.decodeXMLObject(object)
+}
+
+func (xmlCodec) Encode(c *RequestContext, object interface{}) error {
+	return c.WriteXML(object)
+}
+
+func (xmlCodec) StructTag() string {
+	return "xml"
+}
+
+// textCodec is the Codec of text/plain. It decodes into strings, byte slices and encoding.TextUnmarshaler,
+// and encodes with the fmt %v verb, which uses the String method if any.
+type textCodec struct{}
+
+func (textCodec) Decode(c *RequestContext, object interface{}) error {
+	rawBody, err := c.GetRawBody()
+	if err != nil {
+		return err
+	}
+	switch object := object.(type) {
+	case *string:
+		*object = string(rawBody)
+	case *[]byte:
+		*object = append((*object)[:0], rawBody...)
+	case encoding.TextUnmarshaler:
+		return object.UnmarshalText(rawBody)
+	default:
+		return ErrContentTypeNotSupported
+	}
+	return nil
+}
+
+func (textCodec) Encode(c *RequestContext, object interface{}) error {
+	c.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	return c.WriteString(fmt.Sprintf("%v", object))
+}
+
+// formCodec is the Codec of application/x-www-form-urlencoded, see GetFormObject. It only decodes.
+type formCodec struct{}
+
+func (formCodec) Decode(c *RequestContext, object interface{}) error {
+	return c.decodeFormObject(object)
+}
+
+func (formCodec) Encode(c *RequestContext, object interface{}) error {
+	return ErrContentTypeNotSupported
+}
+
+func (formCodec) StructTag() string {
+	return "schema"
+}
+
+// multipartCodec is the Codec of multipart/form-data, see GetMultipartObject. It only decodes.
+type multipartCodec struct{}
+
+func (multipartCodec) Decode(c *RequestContext, object interface{}) error {
+	return c.decodeMultipartObject(object)
+}
+
+func (multipartCodec) Encode(c *RequestContext, object interface{}) error {
+	return ErrContentTypeNotSupported
+}
+
+func (multipartCodec) StructTag() string {
+	return "formdata"
+}
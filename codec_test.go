@@ -0,0 +1,61 @@
+package pi
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// csvCodec decodes and encodes [][]string as CSV.
+type csvCodec struct{}
+
+func (csvCodec) Decode(c *RequestContext, object interface{}) error {
+	records, ok := object.(*[][]string)
+	if !ok {
+		return ErrContentTypeNotSupported
+	}
+	var err error
+	*records, err = csv.NewReader(c.GetBody()).ReadAll()
+	return err
+}
+
+func (csvCodec) Encode(c *RequestContext, object interface{}) error {
+	records, ok := object.([][]string)
+	if !ok {
+		return ErrContentTypeNotSupported
+	}
+	c.SetHeader("Content-Type", "text/csv")
+	return csv.NewWriter(c.W).WriteAll(records)
+}
+
+func TestRegisterCodec(t *testing.T) {
+	p := New()
+	p.RegisterCodec("text/csv", csvCodec{})
+	p.Router("/").Post(func(c *RequestContext) error {
+		var records [][]string
+		if err := c.GetDefaultObject(&records); err != nil {
+			return err
+		}
+		records = append(records, []string{"3", "pi"})
+		return c.WriteDefault(records)
+	})
+	p.Construct()
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("1,a\n2,b\n"))
+	r.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	r.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Body.String() != "1,a\n2,b\n3,pi\n" || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader("1,a\n"))
+	r.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Body.String() != `[["1","a"],["3","pi"]]` {
+		t.Fatalf("expected JSON without Accept header, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,327 @@
+package pi
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncoderFunction returns a WriteCloser compressing the data written to it into w.
+type EncoderFunction func(w io.Writer) (io.WriteCloser, error)
+
+type namedEncoder struct {
+	coding  string
+	encoder EncoderFunction
+}
+
+var (
+	encodersMutex sync.RWMutex
+	encoders      = []namedEncoder{
+		{"gzip", func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		}},
+		{"deflate", func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, flate.DefaultCompression)
+		}},
+	}
+
+	// DefaultCompressionMinSize is the size under which the responses are not compressed when no Compression is given.
+	DefaultCompressionMinSize = 1024
+
+	// DefaultCompressibleContentTypes are the Content-Types compressed when Compression.ContentTypes is empty.
+	DefaultCompressibleContentTypes = []string{
+		"text/*",
+		"application/json",
+		"application/*+json",
+		"application/xml",
+		"application/*+xml",
+		"application/javascript",
+		"application/x-ndjson",
+		"image/svg+xml",
+	}
+)
+
+// RegisterEncoder registers the encoder of a content-coding, such as "br" or "zstd", to be used by CompressionInterceptor.
+// It replaces the encoder already registered for the content-coding, if any.
+// When the client accepts several content-codings with the same preference, the first registered is used,
+// gzip and deflate being registered by default.
+func RegisterEncoder(coding string, encoder EncoderFunction) {
+	encodersMutex.Lock()
+	defer encodersMutex.Unlock()
+	coding = strings.ToLower(coding)
+	for i := range encoders {
+		if encoders[i].coding == coding {
+			encoders[i].encoder = encoder
+			return
+		}
+	}
+	encoders = append(encoders, namedEncoder{coding, encoder})
+}
+
+// getEncoder returns the encoder registered for the content-coding, or nil.
+func getEncoder(coding string) EncoderFunction {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+	for _, e := range encoders {
+		if e.coding == coding {
+			return e.encoder
+		}
+	}
+	return nil
+}
+
+// registeredCodings returns the registered content-codings, in the order of registration.
+func registeredCodings() []string {
+	encodersMutex.RLock()
+	defer encodersMutex.RUnlock()
+	codings := make([]string, len(encoders))
+	for i, e := range encoders {
+		codings[i] = e.coding
+	}
+	return codings
+}
+
+// Compression is the configuration of CompressionInterceptor.
+type Compression struct {
+	// MinSize is the size under which the responses are not compressed.
+	MinSize int
+
+	// ContentTypes lists the Content-Types to compress, they may contain "*" wildcards such as "text/*".
+	// If empty, DefaultCompressibleContentTypes is used.
+	ContentTypes []string
+
+	// Encodings lists the content-codings to use, by order of preference.
+	// If empty, every registered encoder is used, by order of registration.
+	Encodings []string
+}
+
+// compresses checks if the responses of the given Content-Type should be compressed.
+func (compression *Compression) compresses(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "text/event-stream" {
+		return false
+	}
+	contentTypes := compression.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultCompressibleContentTypes
+	}
+	for _, pattern := range contentTypes {
+		if matchWildcard(strings.ToLower(pattern), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate returns the preferred content-coding accepted by the Accept-Encoding header value, or an empty string.
+func (compression *Compression) negotiate(acceptEncoding string) string {
+	codings := compression.Encodings
+	if len(codings) == 0 {
+		codings = registeredCodings()
+	}
+	accepted := make(map[string]float64)
+	for _, value := range splitHeaderValues(acceptEncoding) {
+		parameters := strings.Split(value, ";")
+		q := 1.0
+		for _, parameter := range parameters[1:] {
+			if parameter = strings.TrimSpace(parameter); strings.HasPrefix(parameter, "q=") {
+				if parsed, err := strconv.ParseFloat(parameter[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(parameters[0]))] = q
+	}
+	bestCoding, bestQ := "", 0.0
+	for _, coding := range codings {
+		q, ok := accepted[coding]
+		if !ok {
+			q, ok = accepted["*"]
+		}
+		if ok && q > bestQ && getEncoder(coding) != nil {
+			bestCoding, bestQ = coding, q
+		}
+	}
+	return bestCoding
+}
+
+// CompressionInterceptor returns a Before interceptor compressing the responses according to the
+// Accept-Encoding header of the request. A nil Compression uses DefaultCompressionMinSize and
+// DefaultCompressibleContentTypes. The strong ETag of a compressed response is made weak, W/"v1" instead of "v1",
+// so it does not identify both the compressed and the identity representations.
+// For example:
+//		p.Router("/", ...).Before(pi.CompressionInterceptor(nil))
+//
+func CompressionInterceptor(compression *Compression) HandlerFunction {
+	if compression == nil {
+		compression = &Compression{MinSize: DefaultCompressionMinSize}
+	}
+	return func(c *RequestContext) error {
+		c.AddHeader("Vary", "Accept-Encoding")
+		if c.R.Method == "HEAD" {
+			return nil
+		}
+		coding := compression.negotiate(c.GetHeader("Accept-Encoding"))
+		if coding == "" {
+			return nil
+		}
+		w := &compressWriter{
+			ResponseWriter: c.W,
+			compression:    compression,
+			coding:         coding,
+		}
+		c.W = w
+		c.OnFinish(func() {
+			if err := w.Close(); err != nil && debugMode {
+				writeDebug("CompressionInterceptor", c.R.RemoteAddr, c.RequestID, fmt.Sprintf("cannot close the %s encoder: %s", coding, err))
+			}
+		})
+		return nil
+	}
+}
+
+// compressWriter buffers the beginning of the response to decide if it has to be compressed,
+// then writes it compressed or as is.
+type compressWriter struct {
+	http.ResponseWriter
+	compression *Compression
+	coding      string
+	statusCode  int
+	buffer      []byte
+	decided     bool
+	encoder     io.WriteCloser
+}
+
+// WriteHeader records the status code, which is sent once the compression is decided.
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.statusCode != 0 {
+		return
+	}
+	w.statusCode = statusCode
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified || statusCode == http.StatusPartialContent {
+		w.decide(false)
+	}
+}
+
+// Write buffers the data until the minimum size is reached, then writes it.
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	if !w.decided {
+		w.buffer = append(w.buffer, b...)
+		if len(w.buffer) >= w.compression.MinSize {
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sets the headers according to the compression of the response, sends them and writes the buffered data.
+func (w *compressWriter) decide(minSizeReached bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buffer) != 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buffer))
+	}
+	if minSizeReached && w.statusCode != http.StatusPartialContent && header.Get("Content-Encoding") == "" &&
+		header.Get("Content-Range") == "" && w.compression.compresses(header.Get("Content-Type")) {
+		encoder, err := getEncoder(w.coding)(w.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		w.encoder = encoder
+		header.Set("Content-Encoding", w.coding)
+		header.Del("Content-Length")
+		// The compressed representation is not byte for byte the one identified by a strong ETag,
+		// but it is semantically equivalent, see RFC 7232 section 2.1.
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+	}
+	if w.statusCode != 0 {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+	}
+	buffer := w.buffer
+	w.buffer = nil
+	if len(buffer) != 0 {
+		var err error
+		if w.encoder != nil {
+			_, err = w.encoder.Write(buffer)
+		} else {
+			_, err = w.ResponseWriter.Write(buffer)
+		}
+		return err
+	}
+	return nil
+}
+
+// Close writes the buffered data and closes the encoder, if any.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(len(w.buffer) >= w.compression.MinSize && len(w.buffer) != 0); err != nil {
+			return err
+		}
+	}
+	if w.encoder != nil {
+		return w.encoder.Close()
+	}
+	return nil
+}
+
+// Flush compresses the data even if the minimum size is not reached, as streamed responses are
+// expected to be large, then sends it to the client.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(len(w.buffer) != 0)
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, if the underlying ResponseWriter supports it.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter does not implement http.Hijacker")
+	}
+	w.decided = true
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter, see http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writtenStatusCode returns the status code of the response, even if it has not been sent yet.
+func (w *compressWriter) writtenStatusCode() int {
+	if w.statusCode != 0 {
+		return w.statusCode
+	}
+	if inner, ok := w.ResponseWriter.(statusCodeWriter); ok {
+		return inner.writtenStatusCode()
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package pi
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressionInterceptor(t *testing.T) {
+	large := strings.Repeat("pi ", 1000)
+	p := New()
+	p.Router("/",
+		p.Route("/large").Get(func(c *RequestContext) error {
+			c.SetETag("v1")
+			return c.WriteJSON(large)
+		}),
+		p.Route("/small").Get(func(c *RequestContext) error {
+			return c.WriteJSON("pi")
+		}),
+		p.Route("/image").Get(func(c *RequestContext) error {
+			c.SetHeader("Content-Type", "image/png")
+			c.SetETag("v1")
+			return c.WriteString(large)
+		}),
+	).Before(CompressionInterceptor(nil))
+	p.Construct()
+
+	r := httptest.NewRequest("GET", "/large", nil)
+	r.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" || w.Header().Get("ETag") != `W/"v1"` {
+		t.Fatalf("expected a gzip response, got headers %v", w.Header())
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `"`+large+`"` {
+		t.Fatalf("unexpected uncompressed body %q", body)
+	}
+
+	for _, path := range []string{"/small", "/image"} {
+		r = httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w = httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.Len() == 0 || (path == "/image" && w.Header().Get("ETag") != `"v1"`) {
+			t.Errorf("expected %s not to be compressed, got headers %v", path, w.Header())
+		}
+	}
+}
+
+func TestCompressionNegotiate(t *testing.T) {
+	compression := &Compression{}
+	tests := map[string]string{
+		"":                      "",
+		"gzip, deflate":         "gzip",
+		"deflate, gzip;q=0.1":   "deflate",
+		"*":                     "gzip",
+		"gzip;q=0, *;q=0.5":     "deflate",
+		"br, identity":          "",
+		"GZIP":                  "gzip",
+		"deflate;q=1, gzip;q=1": "gzip",
+	}
+	for acceptEncoding, expected := range tests {
+		if coding := compression.negotiate(acceptEncoding); coding != expected {
+			t.Errorf("negotiate(%q) should be %q, got %q", acceptEncoding, expected, coding)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package pi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrPreconditionFailed is the error when a precondition of a conditional request fails.
+var ErrPreconditionFailed = fmt.Errorf("precondition failed")
+
+// SetETag sets the ETag header of the response. The entity tag is quoted if it is not already,
+// so both "v1", W/"v1" and v1 are accepted.
+func (c *RequestContext) SetETag(etag string) {
+	if !strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+		etag = `"` + etag + `"`
+	}
+	c.SetHeader("ETag", etag)
+}
+
+// SetLastModified sets the Last-Modified header of the response, with a precision of a second.
+func (c *RequestContext) SetLastModified(lastModified time.Time) {
+	c.SetHeader("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+}
+
+// SetCacheControl sets the Cache-Control header of the response with the directives.
+// For example:
+//		c.SetCacheControl("private", "max-age=60")
+//
+func (c *RequestContext) SetCacheControl(directives ...string) {
+	c.SetHeader("Cache-Control", strings.Join(directives, ", "))
+}
+
+// CheckPreconditions evaluates the conditional headers of the request (If-Match, If-Unmodified-Since,
+// If-None-Match and If-Modified-Since) against the ETag and Last-Modified headers already set on the response,
+// following RFC 7232 section 6. When the request is handled, the handler must stop and return err:
+// a 304 Not Modified is written for the GET and HEAD requests whose representation did not change,
+// and err is a 412 HTTPError when a precondition fails, for example an If-Match of a PUT, PATCH or DELETE
+// request sent with an outdated ETag. The resource is assumed to exist, so "*" matches it even if the response
+// has no ETag: when the resource does not exist, for example on a PUT creating it, the handler must reply
+// a 412 to the requests having an If-Match header instead of calling CheckPreconditions.
+//
+// The preconditions of the requests are also checked automatically when the handler writes a 2xx response
+// without having called CheckPreconditions: the response is replaced by a 304 or a 412 as above.
+// So a GET handler only has to set the ETag or the Last-Modified header, but a PUT, PATCH or DELETE handler
+// must call CheckPreconditions before modifying the resource, since the automatic check happens once the
+// resource has been modified, comparing the precondition with the validators of the new representation.
+// For example:
+//		func GetUser(c *pi.RequestContext) error {
+//			user := loadUser(c.GetRouteVariable("id"))
+//			c.SetETag(strconv.Itoa(user.Version))
+//			c.SetLastModified(user.UpdatedAt)
+//			return c.WriteJSON(user) // A 304 is written instead if the client has the current version.
+//		}
+//
+//		func UpdateUser(c *pi.RequestContext) error {
+//			user := loadUser(c.GetRouteVariable("id"))
+//			c.SetETag(strconv.Itoa(user.Version))
+//			if handled, err := c.CheckPreconditions(); handled {
+//				return err
+//			}
+//			// Update the user...
+//			return c.WriteJSON(user)
+//		}
+//
+func (c *RequestContext) CheckPreconditions() (handled bool, err error) {
+	c.preconditionsChecked = true
+	switch c.evaluatePreconditions() {
+	case http.StatusNotModified:
+		c.writeNotModified()
+		return true, nil
+	case http.StatusPreconditionFailed:
+		return true, NewDefaultError(http.StatusPreconditionFailed, ErrPreconditionFailed)
+	}
+	return false, nil
+}
+
+// evaluatePreconditions evaluates the conditional headers of the request against the validators of the
+// response, returning 304 or 412 if the request must be answered without its representation, or 0.
+func (c *RequestContext) evaluatePreconditions() int {
+	etag := c.W.Header().Get("ETag")
+	lastModified, lastModifiedErr := http.ParseTime(c.W.Header().Get("Last-Modified"))
+	hasLastModified := lastModifiedErr == nil
+
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		if !matchETag(ifMatch, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ifUnmodifiedSince, err := http.ParseTime(c.GetHeader("If-Unmodified-Since")); err == nil && hasLastModified {
+		if lastModified.After(ifUnmodifiedSince) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	safe := c.R.Method == "GET" || c.R.Method == "HEAD"
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		if matchETag(ifNoneMatch, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ifModifiedSince, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && hasLastModified && safe {
+		if !lastModified.After(ifModifiedSince) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// ServeContent replies to the request with the content, like http.ServeContent: Range requests are handled,
+// as well as the conditional requests with the ETag set on the response and the modification time.
+// The Content-Type is guessed from the extension of the name, then from the content, if it is not set.
+func (c *RequestContext) ServeContent(name string, modTime time.Time, content io.ReadSeeker) {
+	c.preconditionsChecked = true
+	http.ServeContent(c.W, c.R, name, modTime, content)
+}
+
+// writeNotModified writes a 304 Not Modified, without the headers describing a body.
+func (c *RequestContext) writeNotModified() {
+	header := c.W.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	c.W.WriteHeader(http.StatusNotModified)
+}
+
+// hasPreconditions checks if the request has conditional headers.
+func (c *RequestContext) hasPreconditions() bool {
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if c.GetHeader(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalWriter checks the preconditions of the request when the status code of a 2xx response is written,
+// unless the handler already called CheckPreconditions, and replaces the response by a 304 or a 412 if needed.
+type conditionalWriter struct {
+	http.ResponseWriter
+	c        *RequestContext
+	decided  bool
+	replaced bool
+}
+
+// WriteHeader checks the preconditions before sending the first status code.
+func (w *conditionalWriter) WriteHeader(statusCode int) {
+	if w.replaced {
+		return
+	}
+	if !w.decided {
+		w.decided = true
+		if statusCode >= 200 && statusCode < 300 && !w.c.preconditionsChecked {
+			if w.replace(w.c.evaluatePreconditions()) {
+				return
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write writes the data, unless the response has been replaced.
+func (w *conditionalWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// replace writes the 304 or the 412 instead of the response, returning false if statusCode is 0.
+func (w *conditionalWriter) replace(statusCode int) bool {
+	switch statusCode {
+	case http.StatusNotModified:
+		w.c.writeNotModified()
+	case http.StatusPreconditionFailed:
+		w.c.writeError(NewDefaultError(http.StatusPreconditionFailed, ErrPreconditionFailed))
+	default:
+		return false
+	}
+	w.replaced = true
+	return true
+}
+
+// Flush sends any buffered data to the client, if the underlying ResponseWriter supports it.
+func (w *conditionalWriter) Flush() {
+	if !w.decided {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok && !w.replaced {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, if the underlying ResponseWriter supports it.
+func (w *conditionalWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter does not implement http.Hijacker")
+	}
+	w.decided = true
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter, see http.ResponseController.
+func (w *conditionalWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writtenStatusCode returns the status code sent to the client, or 0 if nothing has been sent yet.
+func (w *conditionalWriter) writtenStatusCode() int {
+	if inner, ok := w.ResponseWriter.(statusCodeWriter); ok {
+		return inner.writtenStatusCode()
+	}
+	return 0
+}
+
+// matchETag checks if the etag matches one of the entity tags of an If-Match or If-None-Match header value.
+// "*" matches the current representation, even without etag. The weak comparison ignores the W/ prefix,
+// the strong comparison never matches weak entity tags.
+func matchETag(headerValue, etag string, weak bool) bool {
+	for _, candidate := range splitETags(headerValue) {
+		if candidate == "*" {
+			return true
+		}
+		if etag == "" {
+			continue
+		}
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// splitETags splits the entity tags of an If-Match or If-None-Match header value,
+// the quoted entity tags possibly containing commas.
+func splitETags(headerValue string) (etags []string) {
+	for headerValue = strings.TrimSpace(headerValue); headerValue != ""; headerValue = strings.TrimLeft(headerValue, ", \t") {
+		if headerValue[0] == '*' {
+			etags = append(etags, "*")
+			headerValue = headerValue[1:]
+			continue
+		}
+		start := 0
+		if strings.HasPrefix(headerValue, "W/") {
+			start = 2
+		}
+		if len(headerValue) <= start || headerValue[start] != '"' {
+			return etags
+		}
+		end := strings.IndexByte(headerValue[start+1:], '"')
+		if end < 0 {
+			return etags
+		}
+		end += start + 2
+		etags = append(etags, headerValue[:end])
+		headerValue = headerValue[end:]
+	}
+	return etags
+}
@@ -0,0 +1,174 @@
+package pi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	handler := func(c *RequestContext) error {
+		c.SetETag("v2")
+		c.SetLastModified(lastModified)
+		c.SetCacheControl("private", "max-age=60")
+		if handled, err := c.CheckPreconditions(); handled {
+			return err
+		}
+		return c.WriteJSON(J{"version": 2})
+	}
+	p := New()
+	p.Router("/users/{id}").Get(handler).Put(handler).Delete(handler)
+	p.Construct()
+
+	tests := []struct {
+		method string
+		header string
+		value  string
+		code   int
+	}{
+		{"GET", "", "", 200},
+		{"GET", "If-None-Match", `"v2"`, 304},
+		{"GET", "If-None-Match", `"v1", W/"v2"`, 304},
+		{"GET", "If-None-Match", `"v1"`, 200},
+		{"GET", "If-None-Match", `*`, 304},
+		{"GET", "If-Modified-Since", lastModified.Format(http.TimeFormat), 304},
+		{"GET", "If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat), 200},
+		{"PUT", "If-Match", `"v2"`, 200},
+		{"PUT", "If-Match", `"v1"`, 412},
+		{"PUT", "If-Match", `W/"v2"`, 412},
+		{"DELETE", "If-Unmodified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat), 412},
+		{"DELETE", "If-Unmodified-Since", lastModified.Format(http.TimeFormat), 200},
+		{"PUT", "If-None-Match", `*`, 412},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "/users/1", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s with %s: %s: expected %d, got %d", test.method, test.header, test.value, test.code, w.Code)
+		}
+		if w.Code == 304 && (w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" || w.Header().Get("ETag") != `"v2"` || w.Header().Get("Cache-Control") != "private, max-age=60") {
+			t.Errorf("expected a 304 without body nor Content-Type, got %q %v", w.Body.String(), w.Header())
+		}
+	}
+}
+
+func TestServeContent(t *testing.T) {
+	p := New()
+	p.Router("/report").Get(func(c *RequestContext) error {
+		c.ServeContent("report.txt", time.Time{}, strings.NewReader("0123456789"))
+		return nil
+	})
+	p.Construct()
+
+	r := httptest.NewRequest("GET", "/report", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != 206 || w.Body.String() != "234" {
+		t.Errorf("expected 206 234, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCheckPreconditionsWithoutETag(t *testing.T) {
+	p := New()
+	p.Router("/users/{id}").Put(func(c *RequestContext) error {
+		if handled, err := c.CheckPreconditions(); handled {
+			return err
+		}
+		return c.WriteJSON(J{"version": 2})
+	})
+	p.Construct()
+
+	tests := []struct {
+		header string
+		value  string
+		code   int
+	}{
+		{"If-Match", `*`, 200},
+		{"If-Match", `"v1"`, 412},
+		{"If-None-Match", `*`, 412},
+		{"If-None-Match", `"v1"`, 200},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("PUT", "/users/1", nil)
+		r.Header.Set(test.header, test.value)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s: %s: expected %d, got %d", test.header, test.value, test.code, w.Code)
+		}
+	}
+}
+
+func TestAutomaticPreconditions(t *testing.T) {
+	lastModified := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	p := New()
+	p.Router("/",
+		p.Route("/users/{id}").Get(func(c *RequestContext) error {
+			if c.GetRouteVariable("id") == "0" {
+				return NewError(404, fmt.Errorf("user not found"))
+			}
+			c.SetETag("v2")
+			c.SetLastModified(lastModified)
+			return c.WriteJSON(J{"version": strings.Repeat("2", 2000)})
+		}).Put(func(c *RequestContext) error {
+			c.SetETag("v2")
+			if handled, err := c.CheckPreconditions(); handled {
+				return err
+			}
+			c.SetETag("v3")
+			return c.WriteJSON(J{"version": 3})
+		}).Delete(func(c *RequestContext) error {
+			c.SetETag("v2")
+			c.W.WriteHeader(204)
+			return nil
+		}),
+	).Before(CompressionInterceptor(nil))
+	p.Construct()
+
+	tests := []struct {
+		method string
+		path   string
+		header string
+		value  string
+		code   int
+	}{
+		{"GET", "/users/1", "If-None-Match", `"v2"`, 304},
+		{"GET", "/users/1", "If-None-Match", `"v1"`, 200},
+		{"GET", "/users/1", "If-Modified-Since", lastModified.Format(http.TimeFormat), 304},
+		{"GET", "/users/1", "If-Match", `"v1"`, 412},
+		{"GET", "/users/0", "If-None-Match", `*`, 404},
+		{"PUT", "/users/1", "If-Match", `"v2"`, 200},
+		{"PUT", "/users/1", "If-Match", `"v1"`, 412},
+		{"DELETE", "/users/1", "If-Match", `"v1"`, 412},
+		{"DELETE", "/users/1", "If-Match", `"v2"`, 204},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		r.Header.Set(test.header, test.value)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%s %s with %s: %s: expected %d, got %d", test.method, test.path, test.header, test.value, test.code, w.Code)
+		}
+		switch w.Code {
+		case 304:
+			if w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "" || w.Header().Get("ETag") != `"v2"` {
+				t.Errorf("expected a 304 without body, got %q %v", w.Body.String(), w.Header())
+			}
+		case 412:
+			if w.Body.String() != `{"errorCode": 412, "errorMessage": "precondition failed"}` {
+				t.Errorf("expected the precondition error, got %q", w.Body.String())
+			}
+		}
+	}
+}
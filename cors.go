@@ -0,0 +1,223 @@
+package pi
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS is the Cross-Origin Resource Sharing configuration of a route.
+// It applies to the route and to its child routes, unless a child route has its own configuration.
+// For example:
+//		p.Router("/api",
+//			p.Route("/users").Get(GetUsersHandler),
+//		).CORS(&pi.CORS{
+//			AllowedOrigins: []string{"https://example.com", "https://*.example.com"},
+//			AllowCredentials: true,
+//			MaxAge: 10 * time.Minute,
+//		})
+//
+type CORS struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests.
+	// An origin may contain "*" wildcards, for example "https://*.example.com", and "*" allows any origin.
+	AllowedOrigins []string
+
+	// AllowedMethods lists the methods allowed in cross-origin requests.
+	// If empty, every method registered on the route is allowed.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers allowed in cross-origin requests, "*" allows any header.
+	// If empty, only the CORS-safelisted request headers are allowed.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers the browser exposes to the caller.
+	ExposedHeaders []string
+
+	// AllowCredentials allows the cross-origin requests to include cookies and authorization headers.
+	// It cannot be combined with the "*" origin, which would let any website read the responses
+	// of the credentialed requests.
+	AllowCredentials bool
+
+	// MaxAge is how long the browser may cache the result of a preflight request.
+	MaxAge time.Duration
+}
+
+// allowsOrigin checks if the origin is allowed.
+func (cors *CORS) allowsOrigin(origin string) bool {
+	for _, pattern := range cors.AllowedOrigins {
+		if matchWildcard(strings.ToLower(pattern), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsAnyOrigin checks if any origin is allowed.
+func (cors *CORS) allowsAnyOrigin() bool {
+	for _, pattern := range cors.AllowedOrigins {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders checks if every requested header is allowed.
+func (cors *CORS) allowsHeaders(requestedHeaders []string) bool {
+	for _, requested := range requestedHeaders {
+		allowed := false
+		for _, header := range cors.AllowedHeaders {
+			if header == "*" || strings.EqualFold(header, requested) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// setAllowOrigin sets the Access-Control-Allow-Origin and Access-Control-Allow-Credentials headers.
+// Credentials are never allowed with the "*" origin.
+func (cors *CORS) setAllowOrigin(c *RequestContext, origin string) {
+	if cors.allowsAnyOrigin() {
+		c.SetHeader("Access-Control-Allow-Origin", "*")
+		return
+	}
+	c.SetHeader("Access-Control-Allow-Origin", origin)
+	if cors.AllowCredentials {
+		c.SetHeader("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// handle sets the CORS headers of the response. It answers the preflight requests, returning true
+// when the request has been handled.
+func (cors *CORS) handle(c *RequestContext, routeMethods []string) bool {
+	c.AddHeader("Vary", "Origin")
+	origin := c.GetHeader("Origin")
+	requestedMethod := c.GetHeader("Access-Control-Request-Method")
+	preflight := c.R.Method == "OPTIONS" && requestedMethod != ""
+	if preflight {
+		c.AddHeader("Vary", "Access-Control-Request-Method")
+		c.AddHeader("Vary", "Access-Control-Request-Headers")
+	}
+	if origin == "" || !cors.allowsOrigin(origin) {
+		if preflight {
+			c.SetStatusCode(http.StatusNoContent)
+		}
+		return preflight
+	}
+	if !preflight {
+		cors.setAllowOrigin(c, origin)
+		if len(cors.ExposedHeaders) != 0 {
+			c.SetHeader("Access-Control-Expose-Headers", strings.Join(cors.ExposedHeaders, ", "))
+		}
+		return false
+	}
+
+	allowedMethods := cors.AllowedMethods
+	if len(allowedMethods) == 0 {
+		allowedMethods = routeMethods
+	}
+	requestedHeaders := splitHeaderValues(c.GetHeader("Access-Control-Request-Headers"))
+	if !containsFold(allowedMethods, requestedMethod) || !cors.allowsHeaders(requestedHeaders) {
+		c.SetStatusCode(http.StatusNoContent)
+		return true
+	}
+	cors.setAllowOrigin(c, origin)
+	c.SetHeader("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+	if len(requestedHeaders) != 0 {
+		c.SetHeader("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+	if cors.MaxAge > 0 {
+		c.SetHeader("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge/time.Second)))
+	}
+	c.SetStatusCode(http.StatusNoContent)
+	return true
+}
+
+// CORS sets the Cross-Origin Resource Sharing configuration of the route and its child routes.
+// The preflight requests are answered automatically, before the Before interceptors are called.
+// It panics if the configuration allows credentials with the "*" origin.
+func (r *Route) CORS(cors *CORS) *Route {
+	if cors != nil && cors.AllowCredentials && cors.allowsAnyOrigin() {
+		panic(`pi: CORS cannot allow credentials with the "*" origin, list the allowed origins instead`)
+	}
+	r.cors = cors
+	return r
+}
+
+// routeCORS returns the CORS configuration of the deepest route having one, or nil.
+func routeCORS(parentRoutes []*Route) *CORS {
+	for i := len(parentRoutes) - 1; i >= 0; i-- {
+		if parentRoutes[i].cors != nil {
+			return parentRoutes[i].cors
+		}
+	}
+	return nil
+}
+
+// routeMethods returns the sorted methods registered on the route.
+func routeMethods(route *Route) []string {
+	methods := make([]string, 0, len(route.Methods))
+	for method := range route.Methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// optionsHandler answers the OPTIONS requests of the routes using CORS without an OPTIONS handler.
+func optionsHandler(methods []string) HandlerFunction {
+	allow := strings.Join(append([]string{"OPTIONS"}, methods...), ", ")
+	return func(c *RequestContext) error {
+		c.SetHeader("Allow", allow)
+		c.SetStatusCode(http.StatusNoContent)
+		return nil
+	}
+}
+
+// splitHeaderValues splits a comma separated header value, trimming the spaces.
+func splitHeaderValues(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// containsFold checks if the values contains the value, ignoring the case.
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard checks if the value matches the pattern, where "*" matches any sequence of characters.
+func matchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
@@ -0,0 +1,114 @@
+package pi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	p := New()
+	p.Router("/api",
+		p.Route("/users").Get(userHandler).Post(userHandler).Before(func(c *RequestContext) error {
+			return NewError(401, fmt.Errorf("unauthorized"))
+		}),
+	).CORS(&CORS{
+		AllowedOrigins:   []string{"https://example.com", "https://*.example.org"},
+		AllowedHeaders:   []string{"Content-Type"},
+		ExposedHeaders:   []string{"X-Total"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	p.Construct()
+
+	r := httptest.NewRequest("OPTIONS", "/api/users", nil)
+	r.Header.Set("Origin", "https://app.example.org")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	r.Header.Set("Access-Control-Request-Headers", "content-type")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected the preflight to be answered before the Before interceptors, got %d", w.Code)
+	}
+	expectedHeaders := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.org",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "content-type",
+		"Access-Control-Max-Age":           "600",
+	}
+	for key, value := range expectedHeaders {
+		if w.Header().Get(key) != value {
+			t.Errorf("expected %s to be %q, got %q", key, value, w.Header().Get(key))
+		}
+	}
+
+	r.Header.Set("Access-Control-Request-Method", "DELETE")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected a preflight for a method not allowed to be refused")
+	}
+
+	r = httptest.NewRequest("GET", "/api/users", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" || w.Header().Get("Access-Control-Expose-Headers") != "X-Total" {
+		t.Errorf("unexpected CORS headers %v", w.Header())
+	}
+
+	r.Header.Set("Origin", "https://evil.com")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected the origin to be refused")
+	}
+}
+
+func TestCORSWildcardOriginWithCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Route.CORS to refuse credentials with the * origin")
+		}
+	}()
+	p := New()
+	p.Router("/api").Get(userHandler).CORS(&CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+}
+
+func TestCORSWildcardOriginNeverSendsCredentials(t *testing.T) {
+	cors := &CORS{AllowedOrigins: []string{"*"}}
+	p := New()
+	p.Router("/api").Get(userHandler).CORS(cors)
+	p.Construct()
+	// The configuration is changed after being validated by Route.CORS.
+	cors.AllowCredentials = true
+
+	r := httptest.NewRequest("GET", "/api", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected the * origin without credentials, got %v", w.Header())
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, value string
+		match          bool
+	}{
+		{"*", "https://example.com", true},
+		{"https://*.example.com", "https://api.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://api.example.com.evil.com", false},
+		{"https://example.com", "https://example.com", true},
+	}
+	for _, test := range tests {
+		if matchWildcard(test.pattern, test.value) != test.match {
+			t.Errorf("matchWildcard(%q, %q) should be %v", test.pattern, test.value, test.match)
+		}
+	}
+}
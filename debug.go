@@ -24,8 +24,13 @@ func SetDebugOutput(writer io.Writer) {
 }
 
 // writeDebug writes debug string formatted as: [GET] to/from [IP address] debug_message.
+// When the request has an ID, it is formatted as: [GET] to/from [IP address] [request ID] debug_message.
 // If you are working on localhost and your machine is using IPV6 addresses, you'll get ::1.
-func writeDebug(method, remoteAddr, output string) {
+func writeDebug(method, remoteAddr, requestID, output string) {
 	ip, _, _ := net.SplitHostPort(remoteAddr)
+	if requestID != "" {
+		fmt.Fprintf(debugOutput, "[%s] to/from [%s] [%s] %s\n", method, ip, requestID, output)
+		return
+	}
 	fmt.Fprintf(debugOutput, "[%s] to/from [%s] %s\n", method, ip, output)
 }
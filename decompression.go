@@ -0,0 +1,137 @@
+package pi
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DecoderFunction returns a ReadCloser decompressing the data read from r.
+type DecoderFunction func(r io.Reader) (io.ReadCloser, error)
+
+var (
+	decodersMutex sync.RWMutex
+	decoders      = map[string]DecoderFunction{
+		"gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"x-gzip": func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		"deflate": func(r io.Reader) (io.ReadCloser, error) {
+			return flate.NewReader(r), nil
+		},
+	}
+
+	// DefaultMaxDecompressedSize is the maximum size of a decompressed request body when
+	// DecompressionInterceptor is given a size lower or equal to 0.
+	DefaultMaxDecompressedSize int64 = 32 << 20
+
+	// ErrContentEncodingNotSupported is the error when the Content-Encoding of the request is not supported.
+	ErrContentEncodingNotSupported = fmt.Errorf("content encoding not supported")
+
+	// ErrDecompressedBodyTooLarge is the error when the decompressed request body exceeds the maximum size.
+	ErrDecompressedBodyTooLarge = fmt.Errorf("decompressed body too large")
+)
+
+// RegisterDecoder registers the decoder of a content-coding, such as "br" or "zstd", to be used by DecompressionInterceptor.
+// It replaces the decoder already registered for the content-coding, if any.
+func RegisterDecoder(coding string, decoder DecoderFunction) {
+	decodersMutex.Lock()
+	defer decodersMutex.Unlock()
+	decoders[strings.ToLower(coding)] = decoder
+}
+
+// getDecoder returns the decoder registered for the content-coding, or nil.
+func getDecoder(coding string) DecoderFunction {
+	decodersMutex.RLock()
+	defer decodersMutex.RUnlock()
+	return decoders[coding]
+}
+
+// DecompressionInterceptor returns a Before interceptor decompressing the request body according to its
+// Content-Encoding header, so GetRawBody and the GetXObject methods read the decompressed body.
+// Reading more than maxDecompressedSize bytes fails with ErrDecompressedBodyTooLarge, to protect against
+// zip bombs; DefaultMaxDecompressedSize is used if maxDecompressedSize is lower or equal to 0.
+// It returns a 415 HTTPError if the Content-Encoding is not supported.
+// For example:
+//		p.Router("/", ...).Before(pi.DecompressionInterceptor(10 << 20))
+//
+func DecompressionInterceptor(maxDecompressedSize int64) HandlerFunction {
+	if maxDecompressedSize <= 0 {
+		maxDecompressedSize = DefaultMaxDecompressedSize
+	}
+	return func(c *RequestContext) error {
+		codings := splitHeaderValues(strings.Join(c.GetHeaders("Content-Encoding"), ","))
+		if len(codings) == 0 {
+			return nil
+		}
+		body := c.R.Body
+		// The codings are listed in the order they were applied.
+		for i := len(codings) - 1; i >= 0; i-- {
+			coding := strings.ToLower(codings[i])
+			if coding == "identity" {
+				continue
+			}
+			decoder := getDecoder(coding)
+			if decoder == nil {
+				return NewError(415, ErrContentEncodingNotSupported)
+			}
+			decoded, err := decoder(body)
+			if err != nil {
+				return NewError(400, err)
+			}
+			body = &closers{Reader: decoded, closers: []io.Closer{decoded, body}}
+		}
+		c.R.Body = &closers{
+			Reader:  &maxSizeReader{reader: body, remaining: maxDecompressedSize, err: ErrDecompressedBodyTooLarge},
+			closers: []io.Closer{body},
+		}
+		c.R.Header.Del("Content-Encoding")
+		c.R.Header.Del("Content-Length")
+		c.R.ContentLength = -1
+		return nil
+	}
+}
+
+// closers is a Reader closing several Closers.
+type closers struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes every Closers, returning the first error.
+func (c *closers) Close() (err error) {
+	for _, closer := range c.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// maxSizeReader is a Reader failing with err when more than a number of bytes are read.
+type maxSizeReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+// Read reads from the underlying Reader, failing if the maximum size is exceeded.
+func (r *maxSizeReader) Read(b []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, r.err
+	}
+	if int64(len(b)) > r.remaining+1 {
+		b = b[:r.remaining+1]
+	}
+	n, err := r.reader.Read(b)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), r.err
+	}
+	return n, err
+}
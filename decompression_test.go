@@ -0,0 +1,57 @@
+package pi
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBody(t *testing.T, data string) *bytes.Buffer {
+	buffer := &bytes.Buffer{}
+	writer := gzip.NewWriter(buffer)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer
+}
+
+func TestDecompressionInterceptor(t *testing.T) {
+	p := New()
+	p.Router("/").Post(func(c *RequestContext) error {
+		object := map[string]string{}
+		if err := c.GetJSONObject(&object); err != nil {
+			return err
+		}
+		return c.WriteString(object["name"])
+	}).Before(DecompressionInterceptor(64))
+	p.Construct()
+
+	r := httptest.NewRequest("POST", "/", gzipBody(t, `{"name": "pi"}`))
+	r.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Body.String() != "pi" {
+		t.Fatalf("expected the body to be decompressed, got %d %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/", gzipBody(t, `{"name": "`+strings.Repeat("pi", 1000)+`"}`))
+	r.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != 413 {
+		t.Fatalf("expected a 413 when the decompressed body is too large, got %d", w.Code)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{}`))
+	r.Header.Set("Content-Encoding", "compress")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != 415 {
+		t.Fatalf("expected a 415 for an unsupported encoding, got %d", w.Code)
+	}
+}
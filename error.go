@@ -1,8 +1,16 @@
 package pi
 
 import (
+	"bytes"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
 	"strconv"
+	"time"
 )
 
 // HTTPError represents a HTTP Error.
@@ -12,14 +20,202 @@ type HTTPError interface {
 	StatusCode() int
 }
 
+// ErrorRenderer is implemented by the HTTPErrors rendering their body according to the request,
+// for example according to its Accept header. When an error is not handled by an Error interceptor,
+// RenderError is called instead of ContentType and Error to write the response.
+type ErrorRenderer interface {
+	RenderError(c *RequestContext) (contentType string, body string)
+}
+
+// HeaderError is implemented by the HTTPErrors setting headers on the response, for example
+// Retry-After or WWW-Authenticate. When an error is not handled by an Error interceptor,
+// its headers are set on the response before its status code is written.
+type HeaderError interface {
+	Headers() http.Header
+}
+
+// requestIDError is implemented by the errors able to write the request ID in their body.
+type requestIDError interface {
+	withRequestID(requestID string) HTTPError
+}
+
+// ErrorOption customizes the errors created by NewError, NewXMLError and NewDefaultError.
+type ErrorOption func(*errorOptions)
+
+type errorOptions struct {
+	message   string
+	public    bool
+	hideCause bool
+	code      string
+	header    http.Header
+}
+
+// PublicMessage sets the message written to the client instead of the message of the wrapped error.
+// The wrapped error is still returned by errors.Unwrap and ErrorCause, so it can be logged
+// by an Error interceptor (see ErrorLoggerInterceptor) without being leaked to the client.
+// For example:
+//		if err := db.QueryRow(query, id).Scan(&user.Name); err != nil {
+//			return pi.NewError(500, err, pi.PublicMessage("cannot load the user"))
+//		}
+//
+func PublicMessage(message string) ErrorOption {
+	return func(options *errorOptions) {
+		options.message = message
+		options.public = true
+	}
+}
+
+// HideCause writes the status text instead of the message of the wrapped error, for example
+// "Internal Server Error", unless a PublicMessage is given. Like with PublicMessage, the wrapped error
+// can still be logged by an Error interceptor.
+// For example:
+//		if err := db.QueryRow(query, id).Scan(&user.Name); err != nil {
+//			return pi.NewError(500, err, pi.HideCause())
+//		}
+//
+func HideCause() ErrorOption {
+	return func(options *errorOptions) {
+		options.hideCause = true
+	}
+}
+
+// ErrorCode sets an application error code written in the body of the error, next to the status code,
+// for example "USER_NOT_FOUND". It is written as "code" in JSON and "errorCode" in XML.
+func ErrorCode(code string) ErrorOption {
+	return func(options *errorOptions) {
+		options.code = code
+	}
+}
+
+// ErrorHeader adds a header to the response written for the error, see HeaderError.
+// For example:
+//		return pi.NewError(405, fmt.Errorf("method not allowed"), pi.ErrorHeader("Allow", "GET, HEAD"))
+//
+func ErrorHeader(key, value string) ErrorOption {
+	return func(options *errorOptions) {
+		if options.header == nil {
+			options.header = make(http.Header)
+		}
+		options.header.Add(key, value)
+	}
+}
+
+// RetryAfter sets the Retry-After header of the response written for the error,
+// in seconds, rounded up.
+func RetryAfter(delay time.Duration) ErrorOption {
+	return func(options *errorOptions) {
+		if options.header == nil {
+			options.header = make(http.Header)
+		}
+		options.header.Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	}
+}
+
+// newErrorOptions applies the options over the message of the wrapped error.
+func newErrorOptions(statusCode int, err error, options []ErrorOption) errorOptions {
+	errorOptions := errorOptions{}
+	if err != nil {
+		errorOptions.message = err.Error()
+	}
+	for _, option := range options {
+		option(&errorOptions)
+	}
+	if errorOptions.hideCause && !errorOptions.public {
+		errorOptions.message = http.StatusText(statusCode)
+		if errorOptions.message == "" {
+			errorOptions.message = http.StatusText(http.StatusInternalServerError)
+		}
+	}
+	return errorOptions
+}
+
+// ErrorCause returns the internal error wrapped by an HTTPError created by NewError, NewXMLError
+// or NewDefaultError, or err itself if it does not wrap any error.
+func ErrorCause(err error) error {
+	if cause := errors.Unwrap(err); cause != nil {
+		return cause
+	}
+	return err
+}
+
+// ErrorLoggerInterceptor returns an Error interceptor logging the method, the URL, the request ID,
+// the status code and the internal cause of the errors (see ErrorCause), which may differ from
+// the public message written to the client. The error is still written to the client.
+// If logger is nil, the errors are logged to the standard error.
+// For example:
+//		p.Router("/", ...).Error(pi.ErrorLoggerInterceptor(nil))
+//
+func ErrorLoggerInterceptor(logger *log.Logger) HandlerErrorFunction {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return func(c *RequestContext, err error) error {
+		statusCode := 500
+		if piError, ok := err.(HTTPError); ok {
+			statusCode = piError.StatusCode()
+		}
+		if c.RequestID != "" {
+			logger.Printf("[%s] %s [%s] %d: %v", c.R.Method, c.R.URL, c.RequestID, statusCode, ErrorCause(err))
+		} else {
+			logger.Printf("[%s] %s %d: %v", c.R.Method, c.R.URL, statusCode, ErrorCause(err))
+		}
+		return nil
+	}
+}
+
+// formatJSONError formats the body of the JSON errors.
+func formatJSONError(statusCode int, message, code, requestID string) string {
+	buffer := bytes.NewBufferString(fmt.Sprintf(`{"errorCode": %d, "errorMessage": %s`, statusCode, strconv.Quote(message)))
+	if code != "" {
+		fmt.Fprintf(buffer, `, "code": %s`, strconv.Quote(code))
+	}
+	if requestID != "" {
+		fmt.Fprintf(buffer, `, "requestId": %s`, strconv.Quote(requestID))
+	}
+	buffer.WriteString("}")
+	return buffer.String()
+}
+
+// formatXMLError formats the body of the XML errors, the message is written as is.
+func formatXMLError(statusCode int, message, code, requestID string) string {
+	buffer := bytes.NewBufferString(fmt.Sprintf(`<error code="%d"`, statusCode))
+	if code != "" {
+		fmt.Fprintf(buffer, ` errorCode="%s"`, escapeXML(code))
+	}
+	if requestID != "" {
+		fmt.Fprintf(buffer, ` requestId="%s"`, escapeXML(requestID))
+	}
+	fmt.Fprintf(buffer, ">%s</error>", message)
+	return buffer.String()
+}
+
+// escapeXML escapes the value to be written in XML text or attributes, as the request IDs
+// created by a custom generator are not validated.
+func escapeXML(value string) string {
+	buffer := &bytes.Buffer{}
+	xml.EscapeText(buffer, []byte(value))
+	return buffer.String()
+}
+
 type _JSONError struct {
 	statusCode int
 	err        string
-	template   string
+	code       string
+	cause      error
+	header     http.Header
+	requestID  string
 }
 
 func (error _JSONError) Error() string {
-	return fmt.Sprintf(error.template, int(error.statusCode), strconv.Quote(error.err))
+	return formatJSONError(error.statusCode, error.err, error.code, error.requestID)
+}
+
+func (error _JSONError) Unwrap() error {
+	return error.cause
+}
+
+func (error _JSONError) Headers() http.Header {
+	return error.header
 }
 
 func (error _JSONError) StatusCode() int {
@@ -30,14 +226,30 @@ func (error _JSONError) ContentType() string {
 	return "application/json; charset=UTF-8"
 }
 
+func (error _JSONError) withRequestID(requestID string) HTTPError {
+	error.requestID = requestID
+	return error
+}
+
 type _XMLError struct {
 	statusCode int
 	err        string
-	template   string
+	code       string
+	cause      error
+	header     http.Header
+	requestID  string
 }
 
 func (error _XMLError) Error() string {
-	return fmt.Sprintf(error.template, int(error.statusCode), error.err)
+	return formatXMLError(error.statusCode, error.err, error.code, error.requestID)
+}
+
+func (error _XMLError) Unwrap() error {
+	return error.cause
+}
+
+func (error _XMLError) Headers() http.Header {
+	return error.header
 }
 
 func (error _XMLError) ContentType() string {
@@ -48,20 +260,171 @@ func (error _XMLError) StatusCode() int {
 	return error.statusCode
 }
 
-// NewError returns a new HTTPError, and outputs it as JSON.
-func NewError(statusCode int, err error) HTTPError {
+func (error _XMLError) withRequestID(requestID string) HTTPError {
+	error.requestID = requestID
+	return error
+}
+
+// NewError returns a new HTTPError wrapping err, and outputs it as JSON.
+// If the request has an ID (see RequestIDInterceptor), it is added to the output.
+// The message of err is written unless a PublicMessage or HideCause is given, see ErrorOption.
+func NewError(statusCode int, err error, options ...ErrorOption) HTTPError {
+	errorOptions := newErrorOptions(statusCode, err, options)
 	return _JSONError{
 		statusCode: statusCode,
-		err:        err.Error(),
-		template:   `{"errorCode": %d, "errorMessage": %s}`,
+		err:        errorOptions.message,
+		code:       errorOptions.code,
+		cause:      err,
+		header:     errorOptions.header,
 	}
 }
 
-// NewXMLError returns a new HTTPError, and outputs it as XML.
-func NewXMLError(statusCode int, err error) HTTPError {
+// NewXMLError returns a new HTTPError wrapping err, and outputs it as XML.
+// If the request has an ID (see RequestIDInterceptor), it is added to the output.
+// The message of err is written unless a PublicMessage or HideCause is given, see ErrorOption.
+func NewXMLError(statusCode int, err error, options ...ErrorOption) HTTPError {
+	errorOptions := newErrorOptions(statusCode, err, options)
 	return _XMLError{
 		statusCode: statusCode,
-		err:        err.Error(),
-		template:   `<error code="%d">%s</error>`,
+		err:        errorOptions.message,
+		code:       errorOptions.code,
+		cause:      err,
+		header:     errorOptions.header,
+	}
+}
+
+// ContentTypeProblemJSON is the MIME of the RFC 7807 problem details in JSON.
+var ContentTypeProblemJSON = "application/problem+json"
+
+type _DefaultError struct {
+	statusCode int
+	err        string
+	code       string
+	cause      error
+	header     http.Header
+}
+
+func (error _DefaultError) Error() string {
+	return formatJSONError(error.statusCode, error.err, error.code, "")
+}
+
+func (error _DefaultError) Unwrap() error {
+	return error.cause
+}
+
+func (error _DefaultError) Headers() http.Header {
+	return error.header
+}
+
+func (error _DefaultError) StatusCode() int {
+	return error.statusCode
+}
+
+func (error _DefaultError) ContentType() string {
+	return "application/json; charset=UTF-8"
+}
+
+func (error _DefaultError) RenderError(c *RequestContext) (string, string) {
+	switch c.NegotiateContentType(ContentTypeJSON, ContentTypeXML, ContentTypeText, ContentTypeProblemJSON) {
+	case ContentTypeXML:
+		buffer := &bytes.Buffer{}
+		xml.EscapeText(buffer, []byte(error.err))
+		xmlError := _XMLError{statusCode: error.statusCode, err: buffer.String(), code: error.code, requestID: c.RequestID}
+		return xmlError.ContentType(), xmlError.Error()
+	case ContentTypeText:
+		if c.RequestID != "" {
+			return "text/plain; charset=utf-8", fmt.Sprintf("%s (request ID: %s)", error.err, c.RequestID)
+		}
+		return "text/plain; charset=utf-8", error.err
+	case ContentTypeProblemJSON:
+		problem := ProblemFrom(error)
+		if c.RequestID != "" {
+			problem.With("requestId", c.RequestID)
+		}
+		return problem.ContentType(), problem.Error()
+	}
+	jsonError := _JSONError{statusCode: error.statusCode, err: error.err, code: error.code, requestID: c.RequestID}
+	return jsonError.ContentType(), jsonError.Error()
+}
+
+// NewDefaultError returns a new HTTPError, and outputs it according to the Accept header of the request,
+// like WriteDefault: as JSON (the default), XML, plain text, or RFC 7807 problem details (application/problem+json).
+// For example:
+//		return pi.NewDefaultError(404, fmt.Errorf("user not found"))
+//		// Accept: application/json	{"errorCode": 404, "errorMessage": "user not found"}
+//		// Accept: application/xml	<error code="404">user not found</error>
+//		// Accept: text/plain		user not found
+//
+// The message of err is written unless a PublicMessage or HideCause is given, see ErrorOption.
+func NewDefaultError(statusCode int, err error, options ...ErrorOption) HTTPError {
+	errorOptions := newErrorOptions(statusCode, err, options)
+	return _DefaultError{
+		statusCode: statusCode,
+		err:        errorOptions.message,
+		code:       errorOptions.code,
+		cause:      err,
+		header:     errorOptions.header,
+	}
+}
+
+// NewUnauthorizedError returns a new 401 HTTPError, written like NewDefaultError, asking the client
+// to authenticate with the challenge in the WWW-Authenticate header.
+// For example:
+//		return pi.NewUnauthorizedError(`Bearer realm="api"`, fmt.Errorf("missing token"))
+//
+func NewUnauthorizedError(challenge string, err error, options ...ErrorOption) HTTPError {
+	return NewDefaultError(http.StatusUnauthorized, err, append([]ErrorOption{ErrorHeader("WWW-Authenticate", challenge)}, options...)...)
+}
+
+// NewTooManyRequestsError returns a new 429 HTTPError, written like NewDefaultError, asking the client
+// to retry after the delay in the Retry-After header.
+func NewTooManyRequestsError(retryAfter time.Duration, err error, options ...ErrorOption) HTTPError {
+	return NewDefaultError(http.StatusTooManyRequests, err, append([]ErrorOption{RetryAfter(retryAfter)}, options...)...)
+}
+
+// NewServiceUnavailableError returns a new 503 HTTPError, written like NewDefaultError, asking the client
+// to retry after the delay in the Retry-After header.
+func NewServiceUnavailableError(retryAfter time.Duration, err error, options ...ErrorOption) HTTPError {
+	return NewDefaultError(http.StatusServiceUnavailable, err, append([]ErrorOption{RetryAfter(retryAfter)}, options...)...)
+}
+
+// writeError writes the error to the response. HTTPErrors are written with their status code and
+// rendered with RenderError if they implement ErrorRenderer, with their headers if they implement HeaderError, other errors are written as a 500 in plain text.
+// The message of the other errors is not written, so internal errors are not leaked: the body is the status text,
+// and the error is only given to the Error interceptors, see ErrorLoggerInterceptor.
+// Nothing is written if the status code of the response has already been written, for example by a stream.
+func (c *RequestContext) writeError(err error) {
+	if c.committed() {
+		if debugMode {
+			writeDebug("writeError", c.R.RemoteAddr, c.RequestID, fmt.Sprintf("response already written, error not sent: %v", err))
+		}
+		return
+	}
+	piError, ok := err.(HTTPError)
+	if !ok {
+		c.W.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.W.WriteHeader(500)
+		c.WriteString(http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if requestIDError, ok := piError.(requestIDError); ok && c.RequestID != "" {
+		piError = requestIDError.withRequestID(c.RequestID)
+	}
+	contentType, body := piError.ContentType(), ""
+	if renderer, ok := piError.(ErrorRenderer); ok {
+		contentType, body = renderer.RenderError(c)
+	} else {
+		body = piError.Error()
+	}
+	if headerError, ok := piError.(HeaderError); ok {
+		for key, values := range headerError.Headers() {
+			c.W.Header().Del(key)
+			for _, value := range values {
+				c.W.Header().Add(key, value)
+			}
+		}
 	}
+	c.W.Header().Set("Content-Type", contentType)
+	c.W.WriteHeader(piError.StatusCode())
+	c.WriteString(body)
 }
@@ -1,9 +1,15 @@
 package pi
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
 	"fmt"
+	"log"
+	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestPiError(t *testing.T) {
@@ -43,3 +49,129 @@ func TestCustomError(t *testing.T) {
 	})
 	p.ListenAndServe(":8080")
 }
+
+func TestNewDefaultError(t *testing.T) {
+	p := New()
+	p.Router("/").Get(func(c *RequestContext) error {
+		return NewDefaultError(418, fmt.Errorf("I'm a <teapot>"))
+	}).Before(RequestIDInterceptor(func() string { return "id" }))
+	p.Construct()
+
+	tests := map[string]string{
+		"":                                  `{"errorCode": 418, "errorMessage": "I'm a <teapot>", "requestId": "id"}`,
+		"application/xml":                   `<error code="418" requestId="id">I&#39;m a &lt;teapot&gt;</error>`,
+		"text/plain":                        `I'm a <teapot> (request ID: id)`,
+		"application/problem+json, */*;q=0": `{"type": "about:blank", "title": "I'm a teapot", "status": 418, "detail": "I'm a <teapot>", "requestId": "id"}`,
+		"image/png":                         `{"errorCode": 418, "errorMessage": "I'm a <teapot>", "requestId": "id"}`,
+	}
+	for accept, expected := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != 418 || w.Body.String() != expected {
+			t.Errorf("expected %s for %q, got %d %s", expected, accept, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestErrorWrapping(t *testing.T) {
+	cause := sql.ErrNoRows
+	tests := []struct {
+		err      HTTPError
+		expected string
+	}{
+		{NewError(404, cause), `{"errorCode": 404, "errorMessage": "sql: no rows in result set"}`},
+		{NewError(404, cause, PublicMessage("user not found"), ErrorCode("USER_NOT_FOUND")), `{"errorCode": 404, "errorMessage": "user not found", "code": "USER_NOT_FOUND"}`},
+		{NewXMLError(404, cause, PublicMessage("user not found"), ErrorCode("USER_NOT_FOUND")), `<error code="404" errorCode="USER_NOT_FOUND">user not found</error>`},
+		{NewDefaultError(500, cause, PublicMessage("")), `{"errorCode": 500, "errorMessage": ""}`},
+		{NewError(500, cause), `{"errorCode": 500, "errorMessage": "sql: no rows in result set"}`},
+		{NewError(500, cause, HideCause()), `{"errorCode": 500, "errorMessage": "Internal Server Error"}`},
+		{NewXMLError(503, cause, HideCause()), `<error code="503">Service Unavailable</error>`},
+		{NewDefaultError(599, cause, HideCause()), `{"errorCode": 599, "errorMessage": "Internal Server Error"}`},
+		{NewDefaultError(500, cause, HideCause(), PublicMessage("cannot load the user")), `{"errorCode": 500, "errorMessage": "cannot load the user"}`},
+	}
+	for _, test := range tests {
+		if test.err.Error() != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, test.err.Error())
+		}
+		if !errors.Is(test.err, sql.ErrNoRows) {
+			t.Errorf("expected %s to wrap sql.ErrNoRows", test.expected)
+		}
+		if ErrorCause(test.err) != cause {
+			t.Errorf("expected the cause of %s to be sql.ErrNoRows, got %v", test.expected, ErrorCause(test.err))
+		}
+	}
+	if err := fmt.Errorf("not wrapped"); ErrorCause(err) != err {
+		t.Errorf("expected an error without cause to be its own cause")
+	}
+	problem := ProblemFrom(NewError(404, cause, PublicMessage("user not found"), ErrorCode("USER_NOT_FOUND")))
+	if expected := `{"type": "about:blank", "title": "Not Found", "status": 404, "detail": "user not found", "code": "USER_NOT_FOUND"}`; problem.Error() != expected {
+		t.Errorf("expected %s, got %s", expected, problem.Error())
+	}
+}
+
+func TestErrorLoggerInterceptor(t *testing.T) {
+	output := &bytes.Buffer{}
+	p := New()
+	p.Router("/users").Get(func(c *RequestContext) error {
+		return NewError(500, fmt.Errorf("pq: connection refused"), PublicMessage("cannot load the users"))
+	}).Before(RequestIDInterceptor(func() string { return "id" })).Error(ErrorLoggerInterceptor(log.New(output, "", 0)))
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if expected := `{"errorCode": 500, "errorMessage": "cannot load the users", "requestId": "id"}`; w.Body.String() != expected {
+		t.Errorf("expected %s, got %s", expected, w.Body.String())
+	}
+	if expected := "[GET] /users [id] 500: pq: connection refused\n"; output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
+
+func TestErrorHeaders(t *testing.T) {
+	tests := []struct {
+		err    error
+		header string
+		value  string
+		status int
+	}{
+		{NewTooManyRequestsError(1500*time.Millisecond, fmt.Errorf("slow down")), "Retry-After", "2", 429},
+		{NewServiceUnavailableError(time.Minute, fmt.Errorf("maintenance")), "Retry-After", "60", 503},
+		{NewUnauthorizedError(`Bearer realm="api"`, fmt.Errorf("missing token")), "WWW-Authenticate", `Bearer realm="api"`, 401},
+		{NewXMLError(405, fmt.Errorf("method not allowed"), ErrorHeader("Allow", "GET")), "Allow", "GET", 405},
+		{NewProblem(429, "").WithHeader("Retry-After", "10"), "Retry-After", "10", 429},
+		{ProblemFrom(NewTooManyRequestsError(time.Second, fmt.Errorf("slow down"))), "Retry-After", "1", 429},
+	}
+	for _, test := range tests {
+		err := test.err
+		p := New()
+		p.Router("/").Get(func(c *RequestContext) error {
+			return err
+		})
+		p.Construct()
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != test.status || w.Header().Get(test.header) != test.value {
+			t.Errorf("expected %d with %s: %s, got %d with %q", test.status, test.header, test.value, w.Code, w.Header().Get(test.header))
+		}
+	}
+}
+
+func TestPlainErrorIsNotLeaked(t *testing.T) {
+	output := &bytes.Buffer{}
+	p := New()
+	p.Router("/users").Get(func(c *RequestContext) error {
+		return fmt.Errorf("pq: password authentication failed for user admin")
+	}).Error(ErrorLoggerInterceptor(log.New(output, "", 0)))
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if w.Code != 500 || w.Body.String() != "Internal Server Error" {
+		t.Errorf("expected 500 Internal Server Error, got %d %s", w.Code, w.Body.String())
+	}
+	if expected := "[GET] /users 500: pq: password authentication failed for user admin\n"; output.String() != expected {
+		t.Errorf("expected %q, got %q", expected, output.String())
+	}
+}
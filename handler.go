@@ -1,9 +1,9 @@
 package pi
 
 import (
-	"fmt"
 	"net/http"
-	"os"
+	pathpkg "path"
+	"path/filepath"
 )
 
 // The HandlerFunction type is an adapter to allow the use of ordinary functions as route handlers.
@@ -17,20 +17,19 @@ type RecovererFunction func(*RequestContext, interface{})
 type HandlerErrorFunction func(*RequestContext, error) error
 
 // ServeFileHandler replies to the request with the contents of the named file or directory.
+// If allowBrowsing is true, the extra path of the request (see GetRouteExtraPath) is served
+// from the named directory, cleaned so no file outside of the directory can be served.
+// See StaticHandler to serve a fs.FS.
 // For example:
 // p := New()
-// p.Router("/files").Get(ServeFileHandler("/tmp"))
+// p.Router("/files").Get(ServeFileHandler("/tmp", true))
 func ServeFileHandler(path string, allowBrowsing bool) HandlerFunction {
-	if debugMode {
-		if allowBrowsing {
-			fmt.Fprintln(os.Stderr, "ServeFileHandler is vulnerable to Directory traversal attack when using allowBrowsing, use with caution!")
-		}
-	}
 	return func(c *RequestContext) error {
+		filePath := path
 		if allowBrowsing {
-			path += c.GetRouteExtraPath()
+			filePath = filepath.Join(path, filepath.FromSlash(pathpkg.Clean("/"+c.GetRouteExtraPath())))
 		}
-		http.ServeFile(c.W, c.R, path)
+		http.ServeFile(c.W, c.R, filePath)
 		return nil
 	}
 }
@@ -0,0 +1,179 @@
+package pi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// JSONDecoding is the configuration of the decoding of the JSON request bodies.
+type JSONDecoding struct {
+	// DisallowUnknownFields rejects the objects having keys not matching any field of the struct.
+	DisallowUnknownFields bool
+
+	// AllowTrailingData accepts the bodies having data after the JSON value, which is ignored.
+	AllowTrailingData bool
+
+	// UseNumber decodes the numbers into an interface{} as json.Number instead of float64.
+	UseNumber bool
+
+	// MaxDepth is the maximum nesting of objects and arrays, it is not limited if lower or equal to 0.
+	MaxDepth int
+}
+
+// SetJSONDecoding sets the configuration of the decoding of the JSON request bodies by
+// GetJSONObject, GetDefaultObject and Bind. By default, every option is disabled: the unknown fields
+// are ignored but the data after the JSON value is rejected.
+func (p *Pi) SetJSONDecoding(options JSONDecoding) {
+	p.jsonDecoding = options
+}
+
+// GetJSONObjectWithOptions works like GetJSONObject, using the given options instead of the ones of the Pi.
+func (c *RequestContext) GetJSONObjectWithOptions(object interface{}, options JSONDecoding) error {
+	if err := c.decodeJSONObjectWithOptions(object, options); err != nil {
+		return err
+	}
+	return validate(object, "json", false)
+}
+
+// jsonDecoding returns the JSON decoding options of the Pi.
+func (c *RequestContext) jsonDecoding() JSONDecoding {
+	if c.pi == nil {
+		return JSONDecoding{}
+	}
+	return c.pi.jsonDecoding
+}
+
+// decodeJSONObjectWithOptions decodes the JSON body into the object, converting the decoding
+// errors into *JSONDecodeError.
+func (c *RequestContext) decodeJSONObjectWithOptions(object interface{}, options JSONDecoding) error {
+	rawBody, err := c.GetRawBody()
+	if err != nil {
+		return err
+	}
+	if options.MaxDepth > 0 {
+		if offset, ok := checkJSONDepth(rawBody, options.MaxDepth); !ok {
+			return &JSONDecodeError{Offset: offset, Message: fmt.Sprintf("maximum depth of %d exceeded", options.MaxDepth)}
+		}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(rawBody))
+	if options.DisallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	if options.UseNumber {
+		decoder.UseNumber()
+	}
+	if err := decoder.Decode(object); err != nil {
+		return newJSONDecodeError(err, decoder.InputOffset())
+	}
+	if !options.AllowTrailingData {
+		offset := decoder.InputOffset()
+		if _, err := decoder.Token(); err != io.EOF {
+			return &JSONDecodeError{Offset: offset, Message: "unexpected data after the JSON value"}
+		}
+	}
+	return nil
+}
+
+// JSONDecodeError is the 400 HTTPError returned when a JSON body cannot be decoded.
+// It is written as JSON, with the offset in the body and the field where the error occurred:
+//		{"errorCode": 400, "errorMessage": "cannot unmarshal string into int", "offset": 12, "field": "age"}
+//
+type JSONDecodeError struct {
+	Offset    int64
+	Field     string
+	Message   string
+	requestID string
+}
+
+// newJSONDecodeError converts the error returned by json.Decoder.Decode into a *JSONDecodeError.
+// The errors not related to the body, such as *json.InvalidUnmarshalError, are returned as is.
+func newJSONDecodeError(err error, offset int64) error {
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxError):
+		return &JSONDecodeError{Offset: syntaxError.Offset, Message: syntaxError.Error()}
+	case errors.As(err, &typeError):
+		return &JSONDecodeError{
+			Offset:  typeError.Offset,
+			Field:   typeError.Field,
+			Message: fmt.Sprintf("cannot unmarshal %s into %s", typeError.Value, typeError.Type),
+		}
+	case err == io.EOF, err == io.ErrUnexpectedEOF:
+		return &JSONDecodeError{Offset: offset, Message: "unexpected end of JSON input"}
+	case strings.HasPrefix(err.Error(), jsonUnknownFieldPrefix):
+		// encoding/json has no error type for the unknown fields, the field is taken from the message
+		// when it has the expected format, it is omitted otherwise.
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), jsonUnknownFieldPrefix))
+		return &JSONDecodeError{Offset: offset, Field: field, Message: "unknown field"}
+	}
+	var invalidUnmarshalError *json.InvalidUnmarshalError
+	if errors.As(err, &invalidUnmarshalError) {
+		return err
+	}
+	return &JSONDecodeError{Offset: offset, Message: "invalid JSON body"}
+}
+
+// jsonUnknownFieldPrefix is the beginning of the message of the errors returned by encoding/json
+// when DisallowUnknownFields is enabled.
+const jsonUnknownFieldPrefix = "json: unknown field "
+
+func (error *JSONDecodeError) Error() string {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, `{"errorCode": %d, "errorMessage": %s, "offset": %d`, error.StatusCode(), strconv.Quote(error.Message), error.Offset)
+	if error.Field != "" {
+		fmt.Fprintf(buffer, `, "field": %s`, strconv.Quote(error.Field))
+	}
+	if error.requestID != "" {
+		fmt.Fprintf(buffer, `, "requestId": %s`, strconv.Quote(error.requestID))
+	}
+	buffer.WriteString("}")
+	return buffer.String()
+}
+
+func (error *JSONDecodeError) StatusCode() int {
+	return 400
+}
+
+func (error *JSONDecodeError) ContentType() string {
+	return "application/json; charset=UTF-8"
+}
+
+func (error *JSONDecodeError) withRequestID(requestID string) HTTPError {
+	withRequestID := *error
+	withRequestID.requestID = requestID
+	return &withRequestID
+}
+
+// checkJSONDepth checks that the objects and arrays of the JSON data are not nested deeper than maxDepth,
+// returning the offset where the maximum depth is exceeded.
+func checkJSONDepth(data []byte, maxDepth int) (offset int64, ok bool) {
+	depth := 0
+	inString, escaped := false, false
+	for i, b := range data {
+		switch {
+		case inString && escaped:
+			escaped = false
+		case inString && b == '\\':
+			escaped = true
+		case inString && b == '"':
+			inString = false
+		case inString:
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			depth++
+			if depth > maxDepth {
+				return int64(i), false
+			}
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,121 @@
+package pi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type jsonDecodingUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func newJSONRequestContext(body string) *RequestContext {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	return newRequestContext(httptest.NewRecorder(), r, "/")
+}
+
+func TestGetJSONObjectWithOptions(t *testing.T) {
+	strict := JSONDecoding{DisallowUnknownFields: true, MaxDepth: 2}
+	tests := []struct {
+		body     string
+		options  JSONDecoding
+		expected string
+	}{
+		{`{"name": "pi", "age": 3}`, strict, ""},
+		{`{"name": "pi", "admin": true}`, JSONDecoding{}, ""},
+		{`{"name": "pi", "admin": true}`, strict, `{"errorCode": 400, "errorMessage": "unknown field", "offset": 29, "field": "admin"}`},
+		{`{"name": "pi"} {}`, strict, `{"errorCode": 400, "errorMessage": "unexpected data after the JSON value", "offset": 14}`},
+		{`{"name": "pi"}garbage`, JSONDecoding{}, `{"errorCode": 400, "errorMessage": "unexpected data after the JSON value", "offset": 14}`},
+		{`{}{}`, JSONDecoding{}, `{"errorCode": 400, "errorMessage": "unexpected data after the JSON value", "offset": 2}`},
+		{`{"name": "pi"} {}`, JSONDecoding{AllowTrailingData: true}, ""},
+		{`{"name": "pi", "age": "3"}`, strict, `{"errorCode": 400, "errorMessage": "cannot unmarshal string into int", "offset": 25, "field": "age"}`},
+		{`{"name": }`, strict, `{"errorCode": 400, "errorMessage": "invalid character '}' looking for beginning of value", "offset": 10}`},
+		{`{"name": "[[[", "age": 1}`, JSONDecoding{MaxDepth: 1}, ""},
+		{`[[[1]]]`, JSONDecoding{MaxDepth: 2}, `{"errorCode": 400, "errorMessage": "maximum depth of 2 exceeded", "offset": 2}`},
+		{``, strict, `{"errorCode": 400, "errorMessage": "unexpected end of JSON input", "offset": 0}`},
+	}
+	for _, test := range tests {
+		var object interface{} = &jsonDecodingUser{}
+		if strings.HasPrefix(test.body, "[") {
+			object = &[]interface{}{}
+		}
+		err := newJSONRequestContext(test.body).GetJSONObjectWithOptions(object, test.options)
+		if test.expected == "" && err != nil {
+			t.Errorf("unexpected error for %s: %v", test.body, err)
+		} else if test.expected != "" && (err == nil || err.Error() != test.expected) {
+			t.Errorf("expected %s for %s, got %v", test.expected, test.body, err)
+		}
+	}
+}
+
+func TestJSONDecodingUseNumber(t *testing.T) {
+	p := New()
+	p.SetJSONDecoding(JSONDecoding{UseNumber: true})
+	p.Router("/").Post(func(c *RequestContext) error {
+		object := map[string]interface{}{}
+		if err := c.GetJSONObject(&object); err != nil {
+			return err
+		}
+		if _, ok := object["id"].(json.Number); !ok {
+			return NewError(500, ErrContentTypeNotSupported)
+		}
+		return c.WriteString(object["id"].(json.Number).String())
+	})
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"id": 12345678901234567890}`)))
+	if w.Body.String() != "12345678901234567890" {
+		t.Fatalf("expected the number to be decoded as json.Number, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestJSONTrailingDataIsRejectedByDefault(t *testing.T) {
+	p := New()
+	p.Router("/").Post(func(c *RequestContext) error {
+		object := map[string]interface{}{}
+		if err := c.GetJSONObject(&object); err != nil {
+			return err
+		}
+		return c.WriteString("ok")
+	})
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"a":1}garbage`))
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	p.ServeHTTP(w, r)
+	if w.Code != 400 {
+		t.Fatalf("expected 400 for trailing data, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestJSONUnknownFieldMessage(t *testing.T) {
+	// The unknown field is taken from the message of encoding/json, which must be checked
+	// again if this test fails after a Go upgrade.
+	decoder := json.NewDecoder(strings.NewReader(`{"admin": true}`))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&jsonDecodingUser{})
+	if err == nil || err.Error() != jsonUnknownFieldPrefix+`"admin"` {
+		t.Fatalf("unexpected message for an unknown field: %v", err)
+	}
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{err, `{"errorCode": 400, "errorMessage": "unknown field", "offset": 3, "field": "admin"}`},
+		{fmt.Errorf("json: unknown field admin"), `{"errorCode": 400, "errorMessage": "unknown field", "offset": 3}`},
+		{fmt.Errorf("json: unknown key \"admin\""), `{"errorCode": 400, "errorMessage": "invalid JSON body", "offset": 3}`},
+	}
+	for _, test := range tests {
+		if decodeError := newJSONDecodeError(test.err, 3); decodeError.Error() != test.expected {
+			t.Errorf("expected %s for %v, got %v", test.expected, test.err, decodeError)
+		}
+	}
+}
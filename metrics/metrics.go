@@ -0,0 +1,284 @@
+/*
+Package metrics collects metrics of the requests handled by pi and exposes them
+in the Prometheus text exposition format.
+
+The requests are labelled by the route pattern (RequestContext.RouteURL), for example
+"/users/{id}", and not by the raw path, to keep the number of series bounded.
+
+Example:
+
+		m := metrics.New()
+		p := pi.New()
+		p.Router("/metrics").Get(m.Handler)
+		m.Register(p.Router("/",
+			p.Route("/users/{id}").Get(GetUserHandler)))
+		p.ListenAndServe(":8080")
+
+*/
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocarina/pi"
+)
+
+// ContentType is the MIME of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the default buckets of the latency histogram, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// startKey is the key of RequestContext.Data holding the start time of the request.
+type startKey struct{}
+
+// routeKey identifies a route and a method.
+type routeKey struct {
+	route  string
+	method string
+}
+
+// requestKey identifies a route, a method and a status code.
+type requestKey struct {
+	routeKey
+	code int
+}
+
+// histogram is a cumulative histogram of request durations.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects request counts, latencies, in-flight requests and errors per route.
+type Metrics struct {
+	buckets   []float64
+	mutex     sync.Mutex
+	requests  map[requestKey]uint64
+	errors    map[routeKey]uint64
+	inFlight  map[routeKey]int64
+	durations map[routeKey]*histogram
+}
+
+// New returns new Metrics using DefaultBuckets for the latency histogram.
+func New() *Metrics {
+	return NewWithBuckets(DefaultBuckets)
+}
+
+// NewWithBuckets returns new Metrics using the given buckets, in seconds, for the latency histogram.
+func NewWithBuckets(buckets []float64) *Metrics {
+	sortedBuckets := make([]float64, len(buckets))
+	copy(sortedBuckets, buckets)
+	sort.Float64s(sortedBuckets)
+	return &Metrics{
+		buckets:   sortedBuckets,
+		requests:  make(map[requestKey]uint64),
+		errors:    make(map[routeKey]uint64),
+		inFlight:  make(map[routeKey]int64),
+		durations: make(map[routeKey]*histogram),
+	}
+}
+
+// Register registers the Before, After and Error interceptors of the Metrics on the route,
+// so every request of the route and of its child routes is measured. The Before interceptor is inserted
+// before the ones already registered on the route, so the requests they reject, for example with a 401,
+// are measured too.
+// The requests rejected before the Before interceptors of the route are not measured: the CORS preflights,
+// the 406 of Produces, and the requests rejected by the Before interceptors of the parent routes.
+// Register the Metrics on the root route to measure the requests rejected by any Before interceptor.
+func (m *Metrics) Register(route *pi.Route) *pi.Route {
+	route.Interceptors.Before = append([]pi.HandlerFunction{m.Before}, route.Interceptors.Before...)
+	return route.After(m.After).Error(m.Error)
+}
+
+// Before is the Before interceptor starting the measure of a request.
+// A request ended by neither After nor Error, because it panicked, is measured once it is finished
+// with the status code written by the Recoverer, or 500 if none was written,
+// so the in-flight requests are always decremented, with or without Recover.
+func (m *Metrics) Before(c *pi.RequestContext) error {
+	if _, ok := c.Data[startKey{}]; ok {
+		return nil
+	}
+	c.Data[startKey{}] = time.Now()
+	m.mutex.Lock()
+	m.inFlight[routeKey{c.RouteURL, c.R.Method}]++
+	m.mutex.Unlock()
+	c.OnFinish(func() {
+		statusCode := 500
+		if c.StatusCodeWritten() {
+			statusCode = c.GetStatusCode()
+		}
+		m.observe(c, statusCode, true)
+	})
+	return nil
+}
+
+// After is the After interceptor ending the measure of a request.
+func (m *Metrics) After(c *pi.RequestContext) error {
+	m.observe(c, c.GetStatusCode(), false)
+	return nil
+}
+
+// Error is the Error interceptor ending the measure of a request that failed.
+// The status code is taken from the pi.HTTPError, or 500 for any other error.
+// It never handles the error, so it is still written to the client.
+func (m *Metrics) Error(c *pi.RequestContext, err error) error {
+	statusCode := 500
+	if httpError, ok := err.(pi.HTTPError); ok {
+		statusCode = httpError.StatusCode()
+	}
+	m.observe(c, statusCode, true)
+	return nil
+}
+
+// Recover is the Recoverer interceptor ending the measure of a request that panicked, with a 500 status code.
+// Registering it on a route means the panics of the route are recovered. It is not needed to measure the panics.
+func (m *Metrics) Recover(c *pi.RequestContext, recovered interface{}) {
+	m.observe(c, 500, true)
+}
+
+// observe records the end of a request measured by Before.
+func (m *Metrics) observe(c *pi.RequestContext, statusCode int, failed bool) {
+	start, ok := c.Data[startKey{}].(time.Time)
+	if !ok {
+		return
+	}
+	delete(c.Data, startKey{})
+	duration := time.Since(start).Seconds()
+	key := routeKey{c.RouteURL, c.R.Method}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inFlight[key]--
+	m.requests[requestKey{key, statusCode}]++
+	if failed {
+		m.errors[key]++
+	}
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[key] = h
+	}
+	for i, bucket := range m.buckets {
+		if duration <= bucket {
+			h.counts[i]++
+		}
+	}
+	h.sum += duration
+	h.count++
+}
+
+// Handler is the route handler writing the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler(c *pi.RequestContext) error {
+	buffer := &bytes.Buffer{}
+	m.WriteTo(buffer)
+	c.SetHeader("Content-Type", ContentType)
+	return c.WriteReader(buffer)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	buffer := &bytes.Buffer{}
+
+	writeHeader(buffer, "pi_http_requests_total", "counter", "Total number of HTTP requests handled, by route, method and status code.")
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		requestKeys = append(requestKeys, key)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		if requestKeys[i].routeKey != requestKeys[j].routeKey {
+			return lessRouteKey(requestKeys[i].routeKey, requestKeys[j].routeKey)
+		}
+		return requestKeys[i].code < requestKeys[j].code
+	})
+	for _, key := range requestKeys {
+		fmt.Fprintf(buffer, "pi_http_requests_total{%s,code=\"%d\"} %d\n", labels(key.routeKey), key.code, m.requests[key])
+	}
+
+	writeHeader(buffer, "pi_http_request_errors_total", "counter", "Total number of HTTP requests that returned an error, by route and method.")
+	for _, key := range sortedRouteKeys(m.errors) {
+		fmt.Fprintf(buffer, "pi_http_request_errors_total{%s} %d\n", labels(key), m.errors[key])
+	}
+
+	writeHeader(buffer, "pi_http_requests_in_flight", "gauge", "Number of HTTP requests being handled, by route and method.")
+	for _, key := range sortedRouteKeys(m.inFlight) {
+		fmt.Fprintf(buffer, "pi_http_requests_in_flight{%s} %d\n", labels(key), m.inFlight[key])
+	}
+
+	writeHeader(buffer, "pi_http_request_duration_seconds", "histogram", "Duration of the HTTP requests in seconds, by route and method.")
+	for _, key := range sortedRouteKeys(m.durations) {
+		h := m.durations[key]
+		for i, bucket := range m.buckets {
+			fmt.Fprintf(buffer, "pi_http_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels(key), formatFloat(bucket), h.counts[i])
+		}
+		fmt.Fprintf(buffer, "pi_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels(key), h.count)
+		fmt.Fprintf(buffer, "pi_http_request_duration_seconds_sum{%s} %s\n", labels(key), formatFloat(h.sum))
+		fmt.Fprintf(buffer, "pi_http_request_duration_seconds_count{%s} %d\n", labels(key), h.count)
+	}
+	return buffer.WriteTo(w)
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// labels returns the route and method labels of a routeKey.
+func labels(key routeKey) string {
+	return fmt.Sprintf(`route="%s",method="%s"`, escapeLabelValue(key.route), escapeLabelValue(key.method))
+}
+
+// escapeLabelValue escapes the backslashes, double quotes and line feeds of a label value.
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats a float as expected by the text exposition format.
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// sortedRouteKeys returns the keys of a map indexed by routeKey, sorted by route then method.
+func sortedRouteKeys(m interface{}) []routeKey {
+	var keys []routeKey
+	switch values := m.(type) {
+	case map[routeKey]uint64:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case map[routeKey]int64:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case map[routeKey]*histogram:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lessRouteKey(keys[i], keys[j])
+	})
+	return keys
+}
+
+// lessRouteKey orders the routeKeys by route then method.
+func lessRouteKey(a, b routeKey) bool {
+	if a.route != b.route {
+		return a.route < b.route
+	}
+	return a.method < b.method
+}
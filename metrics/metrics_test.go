@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gocarina/pi"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	p := pi.New()
+	p.Router("/metrics").Get(m.Handler)
+	m.Register(p.Router("/users",
+		p.Route("/{id}").Get(func(c *pi.RequestContext) error {
+			if c.GetRouteVariable("id") == "0" {
+				return pi.NewError(404, fmt.Errorf("not found"))
+			}
+			return c.WriteString("user")
+		}),
+	))
+	p.Construct()
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/0"} {
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("unexpected Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	output := w.Body.String()
+	for _, expected := range []string{
+		`pi_http_requests_total{route="/users/{id}",method="GET",code="200"} 2`,
+		`pi_http_requests_total{route="/users/{id}",method="GET",code="404"} 1`,
+		`pi_http_request_errors_total{route="/users/{id}",method="GET"} 1`,
+		`pi_http_requests_in_flight{route="/users/{id}",method="GET"} 0`,
+		`pi_http_request_duration_seconds_bucket{route="/users/{id}",method="GET",le="+Inf"} 3`,
+		`pi_http_request_duration_seconds_count{route="/users/{id}",method="GET"} 3`,
+		"# TYPE pi_http_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected %q in output:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "/users/1") {
+		t.Errorf("raw paths must not be used as labels:\n%s", output)
+	}
+}
+
+func TestMetricsPanicWithoutRecover(t *testing.T) {
+	m := New()
+	p := pi.New()
+	m.Register(p.Router("/panic").Get(func(c *pi.RequestContext) error {
+		panic("boom")
+	}))
+	p.Construct()
+
+	func() {
+		defer func() { recover() }()
+		p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	}()
+
+	buffer := &strings.Builder{}
+	m.WriteTo(buffer)
+	for _, expected := range []string{
+		`pi_http_requests_in_flight{route="/panic",method="GET"} 0`,
+		`pi_http_requests_total{route="/panic",method="GET",code="500"} 1`,
+	} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("expected %q in output:\n%s", expected, buffer.String())
+		}
+	}
+}
+
+func TestMetricsRecoveredAndRejected(t *testing.T) {
+	m := New()
+	p := pi.New()
+	m.Register(p.Router("/panic").Get(func(c *pi.RequestContext) error {
+		panic("boom")
+	}).Recover(func(c *pi.RequestContext, recovered interface{}) {
+		c.W.WriteHeader(503)
+	}))
+	m.Register(p.Router("/secret").Get(func(c *pi.RequestContext) error {
+		return c.WriteString("secret")
+	}).Before(func(c *pi.RequestContext) error {
+		return pi.NewError(401, fmt.Errorf("unauthorized"))
+	}))
+	p.Construct()
+
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/secret", nil))
+
+	buffer := &strings.Builder{}
+	m.WriteTo(buffer)
+	for _, expected := range []string{
+		`pi_http_requests_total{route="/panic",method="GET",code="503"} 1`,
+		`pi_http_requests_total{route="/secret",method="GET",code="401"} 1`,
+	} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("expected %q in output:\n%s", expected, buffer.String())
+		}
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if escaped := escapeLabelValue("a\"b\\c\nd"); escaped != `a\"b\\c\nd` {
+		t.Fatalf("unexpected escaped value %q", escaped)
+	}
+}
@@ -0,0 +1,119 @@
+package pi
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+)
+
+var (
+	// ErrTooManyParts is the error when a multipart stream has more parts than allowed by its MultipartLimits.
+	ErrTooManyParts = fmt.Errorf("too many multipart parts")
+
+	// ErrPartTooLarge is the error when a part of a multipart stream is larger than allowed by its MultipartLimits.
+	ErrPartTooLarge = fmt.Errorf("multipart part too large")
+)
+
+// MultipartLimits limits the parts of a multipart stream, see RequestContext.GetMultipartStream.
+// A limit lower or equal to 0 is not enforced.
+type MultipartLimits struct {
+	// MaxPartSize is the maximum number of bytes of each part.
+	MaxPartSize int64
+
+	// MaxParts is the maximum number of parts.
+	MaxParts int
+}
+
+// MultipartStream iterates over the parts of a multipart/form-data body as they are received,
+// without storing them in memory or in temporary files.
+type MultipartStream struct {
+	reader *multipart.Reader
+	limits MultipartLimits
+	parts  int
+}
+
+// MultipartPart is a part of a MultipartStream, read as it is received.
+// Its name and file name are given by FormName and FileName.
+type MultipartPart struct {
+	*multipart.Part
+	reader io.Reader
+}
+
+// GetMultipartStream returns a stream over the parts of the multipart/form-data body, so the handler
+// can process the parts, for example streaming the files to a storage, before the whole body is received.
+// The limits may be nil. A 415 HTTPError is returned if the request is not multipart/form-data,
+// and reading more parts or bytes than allowed by the limits, or than the maximum body size,
+// fails with a 413 HTTPError.
+// For example:
+//		func Upload(c *pi.RequestContext) error {
+//			stream, err := c.GetMultipartStream(&pi.MultipartLimits{MaxPartSize: 100 << 20, MaxParts: 10})
+//			if err != nil {
+//				return err
+//			}
+//			for {
+//				part, err := stream.Next()
+//				if err == io.EOF {
+//					return nil
+//				}
+//				if err != nil {
+//					return err
+//				}
+//				if part.FileName() != "" {
+//					if err := storage.Put(part.FileName(), part); err != nil {
+//						return err
+//					}
+//				}
+//			}
+//		}
+//
+func (c *RequestContext) GetMultipartStream(limits *MultipartLimits) (*MultipartStream, error) {
+	reader, err := c.R.MultipartReader()
+	if err != nil {
+		return nil, NewError(http.StatusUnsupportedMediaType, err)
+	}
+	stream := &MultipartStream{reader: reader}
+	if limits != nil {
+		stream.limits = *limits
+	}
+	return stream, nil
+}
+
+// Next returns the next part of the stream, or io.EOF once every part has been read.
+// The rest of the previous part is skipped.
+func (stream *MultipartStream) Next() (*MultipartPart, error) {
+	part, err := stream.reader.NextPart()
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, bodyError(err)
+	}
+	stream.parts++
+	if stream.limits.MaxParts > 0 && stream.parts > stream.limits.MaxParts {
+		part.Close()
+		return nil, NewError(http.StatusRequestEntityTooLarge, ErrTooManyParts)
+	}
+	multipartPart := &MultipartPart{Part: part, reader: part}
+	if stream.limits.MaxPartSize > 0 {
+		multipartPart.reader = &maxSizeReader{reader: part, remaining: stream.limits.MaxPartSize, err: ErrPartTooLarge}
+	}
+	return multipartPart, nil
+}
+
+// Read reads the content of the part. Reading more bytes than the maximum part size or the maximum
+// body size fails with a 413 HTTPError.
+func (part *MultipartPart) Read(b []byte) (int, error) {
+	n, err := part.reader.Read(b)
+	if err != nil && err != io.EOF {
+		err = bodyError(err)
+	}
+	return n, err
+}
+
+// Value reads the whole content of the part as a string, for example the value of a form field.
+func (part *MultipartPart) Value() (string, error) {
+	value, err := ioutil.ReadAll(part)
+	return string(value), err
+}
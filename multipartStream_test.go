@@ -0,0 +1,93 @@
+package pi
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newMultipartStreamRequest(t *testing.T, fileSize int, fields int) (body *bytes.Buffer, contentType string) {
+	body = &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for i := 0; i < fields; i++ {
+		writer.WriteField("name", "gopher")
+	}
+	file, err := writer.CreateFormFile("file", "data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(bytes.Repeat([]byte("a"), fileSize))
+	writer.Close()
+	return body, writer.FormDataContentType()
+}
+
+func TestGetMultipartStream(t *testing.T) {
+	var received []string
+	p := New()
+	p.Router("/upload").Post(func(c *RequestContext) error {
+		stream, err := c.GetMultipartStream(&MultipartLimits{MaxPartSize: 100, MaxParts: 2})
+		if err != nil {
+			return err
+		}
+		for {
+			part, err := stream.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if part.FileName() != "" {
+				n, err := io.Copy(ioutil.Discard, part)
+				if err != nil {
+					return err
+				}
+				received = append(received, part.FileName()+":"+strings.Repeat("a", int(n)))
+				continue
+			}
+			value, err := part.Value()
+			if err != nil {
+				return err
+			}
+			received = append(received, part.FormName()+"="+value)
+		}
+	})
+	p.Construct()
+
+	tests := []struct {
+		fileSize int
+		fields   int
+		code     int
+		expected string
+	}{
+		{3, 1, 200, "name=gopher,data.bin:aaa"},
+		{100, 1, 200, "name=gopher,data.bin:" + strings.Repeat("a", 100)},
+		{101, 1, 413, `{"errorCode": 413, "errorMessage": "multipart part too large"}`},
+		{3, 2, 413, `{"errorCode": 413, "errorMessage": "too many multipart parts"}`},
+	}
+	for _, test := range tests {
+		received = nil
+		body, contentType := newMultipartStreamRequest(t, test.fileSize, test.fields)
+		r := httptest.NewRequest("POST", "/upload", body)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		result := strings.Join(received, ",")
+		if test.code != 200 {
+			result = w.Body.String()
+		}
+		if w.Code != test.code || result != test.expected {
+			t.Errorf("expected %d %s, got %d %s", test.code, test.expected, w.Code, result)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "/upload", strings.NewReader("{}")))
+	if w.Code != 415 {
+		t.Errorf("expected 415 for a request which is not multipart, got %d", w.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package pi
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaRange is a media range of an Accept header, such as "text/*;q=0.8".
+type MediaRange struct {
+	Type       string
+	Subtype    string
+	Parameters map[string]string
+	Q          float64
+}
+
+// specificity returns how specific the media range is, "*/*" being the least specific.
+func (m MediaRange) specificity() int {
+	switch {
+	case m.Type == "*":
+		return 0
+	case m.Subtype == "*":
+		return 1
+	}
+	return 2 + len(m.Parameters)
+}
+
+// Matches checks if the media type, such as "application/json" or "text/plain; charset=utf-8",
+// is in the media range.
+func (m MediaRange) Matches(mediaType string) bool {
+	offer := parseMediaRange(mediaType)
+	if m.Type != "*" && m.Type != offer.Type {
+		return false
+	}
+	if m.Subtype != "*" && m.Subtype != offer.Subtype {
+		return false
+	}
+	for name, value := range m.Parameters {
+		if !strings.EqualFold(offer.Parameters[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMediaRange parses a media range, without validating it.
+func parseMediaRange(value string) MediaRange {
+	parts := strings.Split(value, ";")
+	mediaRange := MediaRange{Q: 1}
+	fullType := strings.ToLower(strings.TrimSpace(parts[0]))
+	if index := strings.Index(fullType, "/"); index >= 0 {
+		mediaRange.Type, mediaRange.Subtype = fullType[:index], fullType[index+1:]
+	} else {
+		mediaRange.Type, mediaRange.Subtype = fullType, "*"
+	}
+	for _, parameter := range parts[1:] {
+		index := strings.Index(parameter, "=")
+		if index < 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSpace(parameter[:index]))
+		value := strings.Trim(strings.TrimSpace(parameter[index+1:]), `"`)
+		if name == "q" {
+			if q, err := strconv.ParseFloat(value, 64); err == nil && q >= 0 && q <= 1 {
+				mediaRange.Q = q
+			}
+			// The parameters after q are accept-extensions, not media type parameters.
+			break
+		}
+		if mediaRange.Parameters == nil {
+			mediaRange.Parameters = make(map[string]string)
+		}
+		mediaRange.Parameters[name] = value
+	}
+	return mediaRange
+}
+
+// ParseAccept parses the value of an Accept header as described by RFC 7231, section 5.3.2,
+// returning the media ranges sorted by preference: by quality, then by specificity.
+func ParseAccept(accept string) []MediaRange {
+	var mediaRanges []MediaRange
+	for _, value := range splitHeaderValues(accept) {
+		mediaRanges = append(mediaRanges, parseMediaRange(value))
+	}
+	sort.SliceStable(mediaRanges, func(i, j int) bool {
+		if mediaRanges[i].Q != mediaRanges[j].Q {
+			return mediaRanges[i].Q > mediaRanges[j].Q
+		}
+		return mediaRanges[i].specificity() > mediaRanges[j].specificity()
+	})
+	return mediaRanges
+}
+
+// NegotiateContentType returns the offer preferred by the Accept header value, or an empty string
+// if no offer is acceptable. The quality of an offer is the one of the most specific media range
+// matching it; offers with the same quality are preferred in the given order.
+// The first offer is returned when the Accept header is empty.
+// For example:
+//		pi.NegotiateContentType("application/xml;q=0.9, text/*", []string{"application/json", "application/xml", "text/plain"})
+//		// Returns text/plain
+//
+func NegotiateContentType(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	mediaRanges := ParseAccept(accept)
+	bestOffer, bestQ := "", 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, -1
+		for _, mediaRange := range mediaRanges {
+			if mediaRange.specificity() > specificity && mediaRange.Matches(offer) {
+				q, specificity = mediaRange.Q, mediaRange.specificity()
+			}
+		}
+		if q > bestQ {
+			bestOffer, bestQ = offer, q
+		}
+	}
+	return bestOffer
+}
+
+// NegotiateContentType returns the offer preferred by the Accept headers of the request, or an empty string
+// if no offer is acceptable, see NegotiateContentType. It adds Accept to the Vary header of the response.
+func (c *RequestContext) NegotiateContentType(offers ...string) string {
+	c.addVary("Accept")
+	return NegotiateContentType(strings.Join(c.GetAccepts(), ","), offers)
+}
+
+// addVary adds the header to the Vary header of the response, unless it is already present.
+func (c *RequestContext) addVary(header string) {
+	for _, value := range c.W.Header()["Vary"] {
+		if containsFold(splitHeaderValues(value), header) {
+			return
+		}
+	}
+	c.AddHeader("Vary", header)
+}
+
+// Produces restricts the MIME types written by WriteDefault in the route and its child routes.
+// The requests whose Accept header does not accept any of them are answered with a 406 HTTPError
+// before the Before interceptors are called.
+// For example:
+//		p.Route("/reports").Get(GetReportsHandler).Produces(pi.ContentTypeJSON, "text/csv")
+//
+func (r *Route) Produces(mimeTypes ...string) *Route {
+	r.produces = mimeTypes
+	return r
+}
+
+// routeProduces returns the MIME types produced by the deepest route restricting them, or nil.
+func routeProduces(parentRoutes []*Route) []string {
+	for i := len(parentRoutes) - 1; i >= 0; i-- {
+		if parentRoutes[i].produces != nil {
+			return parentRoutes[i].produces
+		}
+	}
+	return nil
+}
+
+// writableContentTypes returns the MIME types WriteDefault may write, in order of preference.
+func (c *RequestContext) writableContentTypes() []string {
+	if c.produces != nil {
+		return c.produces
+	}
+	return c.codecs().mimeTypes
+}
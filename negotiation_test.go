@@ -0,0 +1,63 @@
+package pi
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{ContentTypeJSON, ContentTypeXML, ContentTypeText}
+	tests := map[string]string{
+		"":    ContentTypeJSON,
+		"*/*": ContentTypeJSON,
+		"application/xml;q=0.9, application/json": ContentTypeJSON,
+		"application/xml, application/json;q=0.9": ContentTypeXML,
+		"text/*":                          ContentTypeText,
+		"application/*;q=0.5, text/plain": ContentTypeText,
+		"text/html, */*;q=0.1":            ContentTypeJSON,
+		"application/json;q=0, */*":       ContentTypeXML,
+		"image/png":                       "",
+		"application/json;version=2":      "",
+		"TEXT/PLAIN":                      ContentTypeText,
+	}
+	for accept, expected := range tests {
+		if contentType := NegotiateContentType(accept, offers); contentType != expected {
+			t.Errorf("NegotiateContentType(%q) should be %q, got %q", accept, expected, contentType)
+		}
+	}
+}
+
+func TestWriteDefaultNegotiation(t *testing.T) {
+	p := New()
+	p.Router("/",
+		p.Route("/json").Get(func(c *RequestContext) error {
+			return c.WriteDefault(J{"pi": 3})
+		}).Produces(ContentTypeJSON),
+	).Get(func(c *RequestContext) error {
+		return c.WriteDefault("pi")
+	})
+	p.Construct()
+
+	tests := []struct {
+		path, accept, contentType string
+		statusCode                int
+	}{
+		{"/", "application/xml;q=0.9, application/json", "application/json; charset=utf-8", 200},
+		{"/", "text/*", "text/plain; charset=utf-8", 200},
+		{"/", "image/png", "application/json; charset=UTF-8", 406},
+		{"/json", "application/xml", "application/json; charset=UTF-8", 406},
+		{"/json", "application/*", "application/json; charset=utf-8", 200},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != test.statusCode || w.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("expected %d %s for %s with %q, got %d %s", test.statusCode, test.contentType, test.path, test.accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("expected Vary: Accept, got %q", w.Header().Get("Vary"))
+		}
+	}
+}
@@ -7,18 +7,28 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"time"
 )
 
 // Pi represents the core of the API toolkit.
 type Pi struct {
 	router *pat.Router
 	routes routes
+	tracer Tracer
+
+	maxBodySize          int64
+	multipartMaxMemory   int64
+	multipartMaxDiskSize int64
+	jsonDecoding         JSONDecoding
+	codecs               *codecs
+	renderer             Renderer
 }
 
 // New returns a new Pi.
 func New() *Pi {
 	return &Pi{
 		router: pat.New(),
+		codecs: newDefaultCodecs(),
 	}
 }
 
@@ -34,6 +44,12 @@ func (p *Pi) Route(routeURL string, childRoutes ...*Route) *Route {
 	return newRoute(routeURL, childRoutes...)
 }
 
+// SetTracer sets the Tracer opening spans for every request, for each phase of interceptors
+// of each route and for the handler. See NewTracer.
+func (p *Pi) SetTracer(tracer Tracer) {
+	p.tracer = tracer
+}
+
 // ListenAndServe listens on the TCP network address srv.Addr and then calls
 // Serve to handle requests on incoming connections. If srv.Addr is blank, ":http" is used.
 func (p *Pi) ListenAndServe(addr string) error {
@@ -55,13 +71,34 @@ func (p *Pi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // wrapHandler wraps a route handler to run the interceptors and the handler.
-func wrapHandler(handler HandlerFunction, routeURL string, parentRoutes ...*Route) http.HandlerFunc {
+func (p *Pi) wrapHandler(handler HandlerFunction, routeURL string, parentRoutes ...*Route) http.HandlerFunc {
 	closureParentRoutes := make([]*Route, len(parentRoutes))
 	copy(closureParentRoutes, parentRoutes)
+	cors := routeCORS(closureParentRoutes)
+	methods := routeMethods(closureParentRoutes[len(closureParentRoutes)-1])
+	maxBodySize := p.routeMaxBodySize(closureParentRoutes)
+	produces := routeProduces(closureParentRoutes)
 	return func(w http.ResponseWriter, r *http.Request) {
-		context := newRequestContext(w, r, routeURL)
+		limitBody(w, r, maxBodySize)
+		context := newRequestContext(newResponseWriter(w), r, routeURL)
+		context.pi = p
+		context.produces = produces
+		if debugMode {
+			start := time.Now()
+			defer func() {
+				writeDebug(r.Method, r.RemoteAddr, context.RequestID, fmt.Sprintf("%s %d (%s)", r.URL, context.GetStatusCode(), time.Since(start)))
+			}()
+		}
+		var requestErr error
+		requestSpan := context.startRequestSpan(p.tracer)
+		defer func() {
+			requestSpan.SetAttribute("http.status_code", context.GetStatusCode())
+			requestSpan.End(requestErr)
+		}()
+		defer context.finish()
 		defer func() {
 			if recoveredValue := recover(); recoveredValue != nil {
+				requestErr = fmt.Errorf("panic: %v", recoveredValue)
 				recovered := false
 				for _, parentRoute := range closureParentRoutes {
 					if len(parentRoute.Interceptors.Recoverers) != 0 {
@@ -74,37 +111,60 @@ func wrapHandler(handler HandlerFunction, routeURL string, parentRoutes ...*Rout
 				}
 			}
 		}()
+		if cors != nil && cors.handle(context, methods) {
+			return
+		}
 		errorInterceptors := func(c *RequestContext, err error) {
+			requestErr = err
 			errorsHandled := false
-			for _, parentRoute := range closureParentRoutes {
-				errorsHandled = errorsHandled || parentRoute.Interceptors.runErrorInterceptors(context, err) != nil
-			}
-			if !errorsHandled {
-				if piError, ok := err.(HTTPError); ok {
-					context.W.Header().Set("Content-Type", piError.ContentType())
-					context.W.WriteHeader(piError.StatusCode())
-					context.WriteString(piError.Error())
-				} else {
-					context.W.Header().Set("Content-Type", "text/plain; charset=utf-8")
-					context.W.WriteHeader(500)
-					context.WriteString(err.Error())
+			context.runSpan("error", func() error {
+				for _, parentRoute := range closureParentRoutes {
+					errorsHandled = errorsHandled || parentRoute.Interceptors.runErrorInterceptors(context, err) != nil
 				}
+				return nil
+			})
+			if !errorsHandled {
+				context.writeError(err)
 			}
 		}
+		if produces != nil && context.NegotiateContentType(produces...) == "" {
+			errorInterceptors(context, NewError(406, ErrContentTypeNotSupported))
+			return
+		}
 		for _, parentRoute := range closureParentRoutes {
-			if err := parentRoute.Interceptors.runBeforeInterceptors(context); err != nil {
+			if len(parentRoute.Interceptors.Before) == 0 {
+				continue
+			}
+			err := context.runSpan("before "+parentRoute.RouteURL, func() error {
+				return parentRoute.Interceptors.runBeforeInterceptors(context)
+			})
+			if err != nil {
 				errorInterceptors(context, err)
 				return
 			}
 		}
-		if err := handler(context); err != nil {
+		if context.hasPreconditions() {
+			// Wrapped after the Before interceptors, so the preconditions are checked with the validators
+			// set by the handler, before the compression of the response.
+			context.W = &conditionalWriter{ResponseWriter: context.W, c: context}
+		}
+		err := context.runSpan("handler", func() error {
+			return handler(context)
+		})
+		if err != nil {
 			errorInterceptors(context, err)
 			return
 		}
 		for _, parentRoute := range closureParentRoutes {
 			parentRoute.Interceptors.runAfterAsyncInterceptors(context)
-			if err := parentRoute.Interceptors.runAfterInterceptors(context); err != nil {
-				fmt.Sprintln(os.Stderr, "after interceptor raised error:", err)
+			if len(parentRoute.Interceptors.After) == 0 {
+				continue
+			}
+			err := context.runSpan("after "+parentRoute.RouteURL, func() error {
+				return parentRoute.Interceptors.runAfterInterceptors(context)
+			})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "after interceptor raised error:", err)
 			}
 		}
 	}
@@ -125,6 +185,9 @@ func (p *Pi) constructPath(parentRoutes ...*Route) {
 		routeURL = routeURL[1:]
 	}
 	for method, handler := range lastRoute.Methods {
-		p.router.Add(method, routeURL, wrapHandler(handler, routeURL, parentRoutes...))
+		p.router.Add(method, routeURL, p.wrapHandler(handler, routeURL, parentRoutes...))
+	}
+	if _, ok := lastRoute.Methods["OPTIONS"]; !ok && len(lastRoute.Methods) != 0 && routeCORS(parentRoutes) != nil {
+		p.router.Add("OPTIONS", routeURL, p.wrapHandler(optionsHandler(routeMethods(lastRoute)), routeURL, parentRoutes...))
 	}
 }
@@ -0,0 +1,338 @@
+package pi
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ContentTypeProblemXML is the MIME of the RFC 7807 problem details in XML.
+var ContentTypeProblemXML = "application/problem+xml"
+
+// Problem is an HTTPError written as RFC 7807 problem details.
+// It is written as application/problem+json, or as application/problem+xml when the Accept header
+// of the request prefers XML. The Extensions are written as additional members.
+// For example:
+//		return pi.NewProblem(403, "Your current balance is 30, but that costs 50.").
+//			WithType("https://example.com/probs/out-of-credit").
+//			With("balance", 30)
+//		// Output: {"type": "https://example.com/probs/out-of-credit", "title": "Forbidden", "status": 403,
+//		// "detail": "Your current balance is 30, but that costs 50.", "balance": 30}
+//
+// The Header is set on the response, see HeaderError.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+	Header     http.Header
+}
+
+// NewProblem returns a new Problem of type about:blank, titled with the status text of the status code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// WithType sets the URI identifying the type of the problem.
+func (problem *Problem) WithType(problemType string) *Problem {
+	problem.Type = problemType
+	return problem
+}
+
+// WithTitle sets the summary of the type of the problem.
+func (problem *Problem) WithTitle(title string) *Problem {
+	problem.Title = title
+	return problem
+}
+
+// WithInstance sets the URI identifying the occurrence of the problem.
+func (problem *Problem) WithInstance(instance string) *Problem {
+	problem.Instance = instance
+	return problem
+}
+
+// With sets an extension member. The members of RFC 7807 cannot be overridden.
+func (problem *Problem) With(key string, value interface{}) *Problem {
+	if problem.Extensions == nil {
+		problem.Extensions = make(map[string]interface{})
+	}
+	problem.Extensions[key] = value
+	return problem
+}
+
+// WithHeader adds a header to the response written for the problem.
+func (problem *Problem) WithHeader(key, value string) *Problem {
+	if problem.Header == nil {
+		problem.Header = make(http.Header)
+	}
+	problem.Header.Add(key, value)
+	return problem
+}
+
+// members returns the members of the problem, in order, skipping the empty ones.
+func (problem *Problem) members() (keys []string, values map[string]interface{}) {
+	values = make(map[string]interface{})
+	add := func(key string, value interface{}, empty bool) {
+		if !empty {
+			keys = append(keys, key)
+			values[key] = value
+		}
+	}
+	add("type", problem.Type, problem.Type == "")
+	add("title", problem.Title, problem.Title == "")
+	add("status", problem.Status, problem.Status == 0)
+	add("detail", problem.Detail, problem.Detail == "")
+	add("instance", problem.Instance, problem.Instance == "")
+	var extensionKeys []string
+	for key := range problem.Extensions {
+		if _, ok := values[key]; !ok && key != "type" && key != "title" && key != "status" && key != "detail" && key != "instance" {
+			extensionKeys = append(extensionKeys, key)
+		}
+	}
+	sort.Strings(extensionKeys)
+	for _, key := range extensionKeys {
+		add(key, problem.Extensions[key], false)
+	}
+	return keys, values
+}
+
+// MarshalJSON marshals the problem as a JSON object, the extensions being members of the object.
+func (problem *Problem) MarshalJSON() ([]byte, error) {
+	keys, values := problem.members()
+	buffer := &bytes.Buffer{}
+	buffer.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			buffer.WriteString(", ")
+		}
+		fmt.Fprintf(buffer, "%s: ", strconv.Quote(key))
+		encoder := json.NewEncoder(buffer)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(values[key]); err != nil {
+			return nil, err
+		}
+		// Encode terminates the value with a newline.
+		buffer.Truncate(buffer.Len() - 1)
+	}
+	buffer.WriteString("}")
+	return buffer.Bytes(), nil
+}
+
+// MarshalXML marshals the problem as described by RFC 7807, appendix A.
+// The extensions are converted as their JSON representation would be: objects as elements,
+// arrays as repeated i elements. The keys which are not valid XML names are written as
+// extension elements with a name attribute, for example <extension name="invalid-params[0]">.
+func (problem *Problem) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	keys, values := problem.members()
+	start = xml.StartElement{Name: xml.Name{Space: "urn:ietf:rfc:7807", Local: "problem"}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		output, err := json.Marshal(values[key])
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		if err := json.Unmarshal(output, &value); err != nil {
+			return err
+		}
+		if err := encodeXMLValue(encoder, key, value); err != nil {
+			return err
+		}
+	}
+	if err := encoder.EncodeToken(start.End()); err != nil {
+		return err
+	}
+	return encoder.Flush()
+}
+
+// encodeXMLValue encodes a value decoded from JSON as an XML element.
+func encodeXMLValue(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !isXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: "extension"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: name}},
+		}
+	}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := encodeXMLValue(encoder, key, value[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, element := range value {
+			if err := encodeXMLValue(encoder, "i", element); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprintf("%v", value))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// isXMLName checks if the name can be used as the name of an element without namespace:
+// it starts with a letter or an underscore, followed by letters, digits, underscores, hyphens and dots,
+// and it does not start with xml, which is reserved.
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r), r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (problem *Problem) Error() string {
+	output, err := problem.MarshalJSON()
+	if err != nil {
+		return fmt.Sprintf(`{"status": %d, "detail": %s}`, problem.Status, strconv.Quote(err.Error()))
+	}
+	return string(output)
+}
+
+func (problem *Problem) StatusCode() int {
+	return problem.Status
+}
+
+func (problem *Problem) ContentType() string {
+	return ContentTypeProblemJSON + "; charset=UTF-8"
+}
+
+func (problem *Problem) Headers() http.Header {
+	return problem.Header
+}
+
+// RenderError writes the problem as JSON or XML according to the Accept header of the request,
+// adding the request ID, if any, as the requestId extension.
+func (problem *Problem) RenderError(c *RequestContext) (string, string) {
+	rendered := problem
+	if _, ok := problem.Extensions["requestId"]; !ok && c.RequestID != "" {
+		rendered = problem.copy().With("requestId", c.RequestID)
+	}
+	switch contentType := c.NegotiateContentType(ContentTypeProblemJSON, ContentTypeProblemXML, ContentTypeJSON, ContentTypeXML); contentType {
+	case ContentTypeProblemXML, ContentTypeXML:
+		output, err := xml.Marshal(rendered)
+		if err == nil {
+			return contentType + "; charset=UTF-8", xml.Header + string(output)
+		}
+	case ContentTypeJSON:
+		return contentType + "; charset=UTF-8", rendered.Error()
+	}
+	return rendered.ContentType(), rendered.Error()
+}
+
+// copy returns a copy of the problem, with a copy of its extensions.
+func (problem *Problem) copy() *Problem {
+	copied := *problem
+	copied.Extensions = make(map[string]interface{}, len(problem.Extensions))
+	for key, value := range problem.Extensions {
+		copied.Extensions[key] = value
+	}
+	return &copied
+}
+
+// invalidParams converts the field errors into the invalid-params extension of RFC 7807.
+func invalidParams(fields []FieldError) []map[string]string {
+	params := make([]map[string]string, len(fields))
+	for i, field := range fields {
+		params[i] = map[string]string{"name": field.Field, "reason": field.Message}
+	}
+	return params
+}
+
+// Problem converts the ValidationError into a Problem, listing the fields in the invalid-params extension.
+func (error *ValidationError) Problem() *Problem {
+	return NewProblem(error.StatusCode(), ErrValidation.Error()).With("invalid-params", invalidParams(error.Fields))
+}
+
+// Problem converts the BindingError into a Problem, listing the fields in the invalid-params extension.
+func (error *BindingError) Problem() *Problem {
+	return NewProblem(error.StatusCode(), ErrBinding.Error()).With("invalid-params", invalidParams(error.Fields))
+}
+
+// Problem converts the JSONDecodeError into a Problem, with the offset and field extensions.
+func (error *JSONDecodeError) Problem() *Problem {
+	problem := NewProblem(error.StatusCode(), error.Message).With("offset", error.Offset)
+	if error.Field != "" {
+		problem.With("field", error.Field)
+	}
+	return problem
+}
+
+// ProblemFrom converts an error into a Problem:
+// ValidationError, BindingError and JSONDecodeError are converted with their Problem method,
+// the errors created by NewError, NewXMLError and NewDefaultError keep their status code, public message and error code,
+// other HTTPErrors keep their status code, and other errors become a 500 Problem without detail,
+// so internal messages are not leaked. The headers of the errors implementing HeaderError are kept.
+// For example:
+//		if err := c.Bind(request); err != nil {
+//			return pi.ProblemFrom(err)
+//		}
+//
+func ProblemFrom(err error) *Problem {
+	var problem *Problem
+	switch typedErr := err.(type) {
+	case *Problem:
+		return typedErr
+	case interface{ Problem() *Problem }:
+		problem = typedErr.Problem()
+	case _JSONError:
+		problem = newCodeProblem(typedErr.statusCode, typedErr.err, typedErr.code)
+	case _XMLError:
+		problem = newCodeProblem(typedErr.statusCode, typedErr.err, typedErr.code)
+	case _DefaultError:
+		problem = newCodeProblem(typedErr.statusCode, typedErr.err, typedErr.code)
+	case HTTPError:
+		problem = NewProblem(typedErr.StatusCode(), "")
+	default:
+		return NewProblem(http.StatusInternalServerError, "")
+	}
+	if headerError, ok := err.(HeaderError); ok && problem.Header == nil && headerError.Headers() != nil {
+		problem.Header = headerError.Headers().Clone()
+	}
+	return problem
+}
+
+// newCodeProblem returns a new Problem with the application error code as "code" extension, if any.
+func newCodeProblem(statusCode int, detail string, code string) *Problem {
+	problem := NewProblem(statusCode, detail)
+	if code != "" {
+		problem.With("code", code)
+	}
+	return problem
+}
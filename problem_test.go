@@ -0,0 +1,81 @@
+package pi
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProblem(t *testing.T) {
+	problem := NewProblem(403, "Your current balance is 30, but that costs 50.").
+		WithType("https://example.com/probs/out-of-credit").
+		WithInstance("/account/12345/msgs/abc").
+		With("balance", 30).
+		With("accounts", []string{"/account/12345", "/account/67890"}).
+		With("status", 200)
+
+	p := New()
+	p.Router("/").Get(func(c *RequestContext) error {
+		return problem
+	})
+	p.Construct()
+
+	tests := map[string]struct{ contentType, body string }{
+		"": {
+			"application/problem+json; charset=UTF-8",
+			`{"type": "https://example.com/probs/out-of-credit", "title": "Forbidden", "status": 403, "detail": "Your current balance is 30, but that costs 50.", "instance": "/account/12345/msgs/abc", "accounts": ["/account/12345","/account/67890"], "balance": 30}`,
+		},
+		"application/problem+xml": {
+			"application/problem+xml; charset=UTF-8",
+			`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<problem xmlns="urn:ietf:rfc:7807"><type>https://example.com/probs/out-of-credit</type><title>Forbidden</title><status>403</status><detail>Your current balance is 30, but that costs 50.</detail><instance>/account/12345/msgs/abc</instance><accounts><i>/account/12345</i><i>/account/67890</i></accounts><balance>30</balance></problem>`,
+		},
+	}
+	for accept, expected := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != 403 || w.Header().Get("Content-Type") != expected.contentType || w.Body.String() != expected.body {
+			t.Errorf("unexpected response for %q: %d %s\n%s", accept, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+}
+
+func TestProblemFrom(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{NewValidationError(FieldError{"email", "is required"}), `{"type": "about:blank", "title": "Unprocessable Entity", "status": 422, "detail": "validation failed", "invalid-params": [{"name":"email","reason":"is required"}]}`},
+		{&BindingError{Fields: []FieldError{{"page", "must be an integer"}}}, `{"type": "about:blank", "title": "Bad Request", "status": 400, "detail": "binding failed", "invalid-params": [{"name":"page","reason":"must be an integer"}]}`},
+		{NewError(404, fmt.Errorf("user not found")), `{"type": "about:blank", "title": "Not Found", "status": 404, "detail": "user not found"}`},
+		{fmt.Errorf("pq: connection refused"), `{"type": "about:blank", "title": "Internal Server Error", "status": 500}`},
+	}
+	for _, test := range tests {
+		if problem := ProblemFrom(test.err); problem.Error() != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, problem.Error())
+		}
+	}
+}
+
+func TestProblemXMLInvalidExtensionKeys(t *testing.T) {
+	problem := NewProblem(400, "").
+		With("a b", 1).
+		With("<script>", "x").
+		With("xmlns", "urn:evil").
+		With("nested", map[string]interface{}{"1st": true, "ok": "y"})
+	output, err := xml.Marshal(problem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<problem xmlns="urn:ietf:rfc:7807"><type>about:blank</type><title>Bad Request</title><status>400</status>` +
+		`<extension name="&lt;script&gt;">x</extension><extension name="a b">1</extension>` +
+		`<nested><extension name="1st">true</extension><ok>y</ok></nested><extension name="xmlns">urn:evil</extension></problem>`
+	if string(output) != expected {
+		t.Fatalf("unexpected XML %s", output)
+	}
+	if err := xml.Unmarshal(output, &struct{}{}); err != nil {
+		t.Fatalf("invalid XML: %v", err)
+	}
+}
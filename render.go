@@ -0,0 +1,205 @@
+package pi
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrRendererNotSet is the error when rendering a template without Renderer set on the Pi.
+	ErrRendererNotSet = fmt.Errorf("renderer not set")
+
+	// ErrTemplateNotFound is the error when rendering a template which does not exist.
+	ErrTemplateNotFound = fmt.Errorf("template not found")
+)
+
+// Renderer renders named templates, see Pi.SetRenderer and RequestContext.Render.
+type Renderer interface {
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+// Templates configures a TemplateRenderer.
+type Templates struct {
+	// Extension is the extension of the template files, .html if empty.
+	Extension string
+
+	// Layouts is the pattern (see path.Match) of the layout templates, layouts/* if empty.
+	Layouts string
+
+	// Partials is the pattern (see path.Match) of the partial templates, partials/* if empty.
+	Partials string
+
+	// Funcs are the functions available in every template.
+	Funcs template.FuncMap
+
+	// Reload loads the templates again on every render, so they can be edited without restarting
+	// the server. The templates are also reloaded in debug mode, see SetDebug.
+	Reload bool
+}
+
+// TemplateRenderer is a Renderer of html/template templates loaded from a fs.FS.
+// Every template file which is not a layout nor a partial is a page, rendered by its path, with or without
+// the extension. Each page is parsed with every layout and partial, so it can call them and define
+// the blocks they use.
+// For example, with the layout layouts/base.html:
+//		<html><body>{{block "content" .}}{{end}}{{template "partials/footer.html" .}}</body></html>
+//
+// the page users/show.html, rendered with c.Render("users/show", user), uses the layout like this:
+//		{{template "layouts/base.html" .}}
+//		{{define "content"}}<h1>{{.Name}}</h1>{{end}}
+//
+type TemplateRenderer struct {
+	fsys      fs.FS
+	templates Templates
+	mutex     sync.RWMutex
+	pages     map[string]*template.Template
+}
+
+// NewTemplateRenderer returns a new TemplateRenderer loading the templates from the file system once,
+// returning the first parsing error. If templates is nil, the default configuration is used.
+// For example:
+//		//go:embed templates
+//		var templates embed.FS
+//
+//		views, _ := fs.Sub(templates, "templates")
+//		renderer, err := pi.NewTemplateRenderer(views, &pi.Templates{Funcs: template.FuncMap{"upper": strings.ToUpper}})
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//		p.SetRenderer(renderer)
+//
+func NewTemplateRenderer(fsys fs.FS, templates *Templates) (*TemplateRenderer, error) {
+	renderer := &TemplateRenderer{fsys: fsys}
+	if templates != nil {
+		renderer.templates = *templates
+	}
+	if renderer.templates.Extension == "" {
+		renderer.templates.Extension = ".html"
+	}
+	if renderer.templates.Layouts == "" {
+		renderer.templates.Layouts = "layouts/*"
+	}
+	if renderer.templates.Partials == "" {
+		renderer.templates.Partials = "partials/*"
+	}
+	if err := renderer.load(); err != nil {
+		return nil, err
+	}
+	return renderer, nil
+}
+
+// Render renders the page to the writer.
+func (renderer *TemplateRenderer) Render(w io.Writer, name string, data interface{}) error {
+	if renderer.templates.Reload || debugMode {
+		if err := renderer.load(); err != nil {
+			return err
+		}
+	}
+	if !strings.HasSuffix(name, renderer.templates.Extension) {
+		name += renderer.templates.Extension
+	}
+	renderer.mutex.RLock()
+	page, ok := renderer.pages[name]
+	renderer.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return page.ExecuteTemplate(w, name, data)
+}
+
+// load parses the layouts and partials, then every page with them.
+func (renderer *TemplateRenderer) load() error {
+	var shared, pages []string
+	err := fs.WalkDir(renderer.fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || path.Ext(name) != renderer.templates.Extension {
+			return err
+		}
+		if renderer.isShared(name) {
+			shared = append(shared, name)
+		} else {
+			pages = append(pages, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	base := template.New("").Funcs(renderer.templates.Funcs)
+	for _, name := range shared {
+		if err := renderer.parse(base, name); err != nil {
+			return err
+		}
+	}
+	loaded := make(map[string]*template.Template, len(pages))
+	for _, name := range pages {
+		page, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		if err := renderer.parse(page, name); err != nil {
+			return err
+		}
+		loaded[name] = page
+	}
+	renderer.mutex.Lock()
+	renderer.pages = loaded
+	renderer.mutex.Unlock()
+	return nil
+}
+
+// isShared checks if the template is a layout or a partial.
+func (renderer *TemplateRenderer) isShared(name string) bool {
+	for _, pattern := range []string{renderer.templates.Layouts, renderer.templates.Partials} {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// parse parses the template file in the set, named by its path.
+func (renderer *TemplateRenderer) parse(set *template.Template, name string) error {
+	content, err := fs.ReadFile(renderer.fsys, name)
+	if err != nil {
+		return err
+	}
+	_, err = set.New(name).Parse(string(content))
+	return err
+}
+
+// SetRenderer sets the Renderer used by RequestContext.Render, see NewTemplateRenderer.
+func (p *Pi) SetRenderer(renderer Renderer) {
+	p.renderer = renderer
+}
+
+// Render renders the named template with the Renderer set on the Pi, as text/html unless the Content-Type
+// of the response is already set. The template is rendered in memory first, so a rendering error
+// is returned before anything is written and can still be answered with an error page.
+// For example:
+//		func ShowUser(c *pi.RequestContext) error {
+//			return c.Render("users/show", loadUser(c.GetRouteVariable("id")))
+//		}
+//
+func (c *RequestContext) Render(name string, data interface{}) error {
+	if c.pi == nil || c.pi.renderer == nil {
+		return ErrRendererNotSet
+	}
+	buffer := &bytes.Buffer{}
+	if err := c.pi.renderer.Render(buffer, name, data); err != nil {
+		return err
+	}
+	if c.W.Header().Get("Content-Type") == "" {
+		c.SetHeader("Content-Type", "text/html; charset=utf-8")
+	}
+	if debugMode {
+		writeDebug("Render", c.R.RemoteAddr, c.RequestID, name)
+	}
+	_, err := buffer.WriteTo(c.W)
+	return err
+}
@@ -0,0 +1,88 @@
+package pi
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRender(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html":    {Data: []byte(`<title>{{block "title" .}}pi{{end}}</title>{{block "content" .}}{{end}}{{template "partials/footer.html" .}}`)},
+		"partials/footer.html": {Data: []byte(`<footer>{{upper "footer"}}</footer>`)},
+		"users/show.html":      {Data: []byte(`{{template "layouts/base.html" .}}{{define "title"}}{{.Name}}{{end}}{{define "content"}}<h1>{{.Name}}</h1>{{end}}`)},
+		"home.html":            {Data: []byte(`{{template "layouts/base.html" .}}{{define "content"}}home{{end}}`)},
+		"broken.html":          {Data: []byte(`start {{fail}}`)},
+	}
+	renderer, err := NewTemplateRenderer(fsys, &Templates{Funcs: template.FuncMap{
+		"upper": strings.ToUpper,
+		"fail":  func() (string, error) { return "", fmt.Errorf("failure") },
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New()
+	p.SetRenderer(renderer)
+	var renderErr error
+	p.Router("/{page:.*}").Get(func(c *RequestContext) error {
+		return c.Render(c.GetRouteVariable("page"), J{"Name": "<gopher>"})
+	}).Error(func(c *RequestContext, err error) error {
+		renderErr = err
+		return nil
+	})
+	p.Construct()
+
+	tests := []struct {
+		path     string
+		code     int
+		expected string
+	}{
+		{"/users/show", 200, `<title>&lt;gopher&gt;</title><h1>&lt;gopher&gt;</h1><footer>FOOTER</footer>`},
+		{"/home.html", 200, `<title>pi</title>home<footer>FOOTER</footer>`},
+		{"/missing", 500, "template not found: missing.html"},
+		{"/broken", 500, "error calling fail: failure"},
+	}
+	for _, test := range tests {
+		renderErr = nil
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if test.code == 500 {
+			// The rendering errors, prefixed by the position of the error, are written as a 500 instead of the partially rendered page.
+			if w.Code != 500 || w.Body.String() != "Internal Server Error" || renderErr == nil || !strings.HasSuffix(renderErr.Error(), test.expected) {
+				t.Errorf("%s: expected 500 %s, got %d %s %v", test.path, test.expected, w.Code, w.Body.String(), renderErr)
+			}
+			continue
+		}
+		if w.Code != test.code || w.Body.String() != test.expected {
+			t.Errorf("%s: expected %d %s, got %d %s", test.path, test.code, test.expected, w.Code, w.Body.String())
+		}
+		if test.code == 200 && w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("%s: expected text/html, got %s", test.path, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestTemplateRendererReload(t *testing.T) {
+	fsys := fstest.MapFS{"page.html": {Data: []byte(`v1`)}}
+	renderer, err := NewTemplateRenderer(fsys, &Templates{Reload: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys["page.html"] = &fstest.MapFile{Data: []byte(`v2`)}
+	output := &strings.Builder{}
+	if err := renderer.Render(output, "page", nil); err != nil || output.String() != "v2" {
+		t.Errorf("expected the reloaded template v2, got %s %v", output.String(), err)
+	}
+
+	fsys["invalid.html"] = &fstest.MapFile{Data: []byte(`{{`)}
+	if _, err := NewTemplateRenderer(fsys, nil); err == nil {
+		t.Errorf("expected a parsing error")
+	}
+	if err := (&RequestContext{}).Render("page", nil); !errors.Is(err, ErrRendererNotSet) {
+		t.Errorf("expected ErrRendererNotSet, got %v", err)
+	}
+}
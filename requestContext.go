@@ -1,6 +1,7 @@
 package pi
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -12,7 +13,6 @@ import (
 	"mime/multipart"
 	"net/http"
 	"strconv"
-	"strings"
 )
 
 var (
@@ -50,10 +50,21 @@ type J map[string]interface{}
 // RequestContext represents the context of the HTTP request.
 // It is shared across interceptors and handler.
 type RequestContext struct {
-	W        http.ResponseWriter
-	R        *http.Request
-	RouteURL string
-	Data     map[interface{}]interface{}
+	W         http.ResponseWriter
+	R         *http.Request
+	RouteURL  string
+	RequestID string
+	Data      map[interface{}]interface{}
+	pi        *Pi
+	rawBody   []byte
+	bodyRead  bool
+	bodyErr   error
+	tracer    Tracer
+	span      Span
+	produces  []string
+	finishers []func()
+
+	preconditionsChecked bool
 }
 
 // newRequestContext returns a new RequestContext.
@@ -84,7 +95,7 @@ func (c *RequestContext) WriteJSON(object interface{}) error {
 		if err != nil {
 			return err
 		}
-		writeDebug("WriteJSON", c.R.RemoteAddr, string(output))
+		writeDebug("WriteJSON", c.R.RemoteAddr, c.RequestID, string(output))
 		c.W.Write(output)
 	} else {
 		output, err := json.Marshal(object)
@@ -104,7 +115,7 @@ func (c *RequestContext) WriteXML(object interface{}) error {
 		if err != nil {
 			return err
 		}
-		writeDebug("WriteXML", c.R.RemoteAddr, string(output))
+		writeDebug("WriteXML", c.R.RemoteAddr, c.RequestID, string(output))
 		c.W.Write(output)
 	} else {
 		output, err := xml.Marshal(object)
@@ -116,38 +127,58 @@ func (c *RequestContext) WriteXML(object interface{}) error {
 	return nil
 }
 
-// WriteDefault writes the object to the caller according to the acceptable MIME in the Accept header value.
+// WriteDefault writes the object to the caller according to the acceptable MIME in the Accept header value,
+// using the Codecs registered on the Pi (see Pi.RegisterCodec and NegotiateContentType).
 // If the MIME is not supported, it sends a 406 Not Acceptable request.
 // text/plain uses the String method to be serialized.
-// Mime supported for write:
+// Mime supported for write by default:
 //
 //		application/json
 //		application/xml
 //		text/plain
 //
 // If no Accept header is present, it writes the object as JSON.
+// The MIME written can be restricted with Route.Produces. Accept is added to the Vary header of the response.
 func (c *RequestContext) WriteDefault(object interface{}) error {
-	acceptedContentType := c.GetAccepts()
-	for _, contentType := range acceptedContentType {
-		switch contentType {
-		case ContentTypeText:
-			return c.WriteString(fmt.Sprintf("%v", object))
-		case ContentTypeJSON, "*/*":
-			return c.WriteJSON(object)
-		case ContentTypeXML:
-			return c.WriteXML(object)
+	registry := c.codecs()
+	var offers []string
+	for _, mimeType := range c.writableContentTypes() {
+		if registry.get(mimeType) != nil {
+			offers = append(offers, mimeType)
 		}
 	}
+	for len(offers) != 0 {
+		contentType := c.NegotiateContentType(offers...)
+		if contentType == "" {
+			break
+		}
+		if err := registry.get(contentType).Encode(c, object); err != ErrContentTypeNotSupported {
+			return err
+		}
+		offers = removeString(offers, contentType)
+	}
 	return NewError(406, ErrContentTypeNotSupported)
 }
 
+// removeString returns the values without the value.
+func removeString(values []string, value string) []string {
+	var result []string
+	for _, v := range values {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 // WriteReader copy the reader to the ResponseWriter.
 func (c *RequestContext) WriteReader(reader io.Reader) error {
 	_, err := io.Copy(c.W, reader)
 	return err
 }
 
-// WriteTemplate writes the given template to the ResponseWriter.
+// WriteTemplateFile parses the given template file and writes it to the ResponseWriter.
+// The file is parsed on every call, see Render to render templates loaded once.
 func (c *RequestContext) WriteTemplateFile(filename string, data interface{}) error {
 	tmplate, err := template.ParseFiles(filename)
 	if err != nil {
@@ -161,95 +192,187 @@ func (c *RequestContext) SetStatusCode(statusCode int) {
 	c.W.WriteHeader(statusCode)
 }
 
+// OnFinish registers a function called once the request has been handled, after the After interceptors
+// or the error handling. The functions are called in the reverse order of registration.
+func (c *RequestContext) OnFinish(finisher func()) {
+	c.finishers = append(c.finishers, finisher)
+}
+
+// finish calls the functions registered with OnFinish.
+func (c *RequestContext) finish() {
+	for i := len(c.finishers) - 1; i >= 0; i-- {
+		c.finishers[i]()
+	}
+	c.finishers = nil
+}
+
+// GetStatusCode returns the status code sent to the client, or 200 if nothing has been sent yet.
+func (c *RequestContext) GetStatusCode() int {
+	if w, ok := c.W.(statusCodeWriter); ok && w.writtenStatusCode() != 0 {
+		return w.writtenStatusCode()
+	}
+	return http.StatusOK
+}
+
+// StatusCodeWritten returns true if the status code has already been sent to the client.
+func (c *RequestContext) StatusCodeWritten() bool {
+	return c.committed()
+}
+
 // GetBody return the body as a ReadCloser. It is the client responsibility to close the body.
+// Once the body has been read with GetRawBody or any GetXObject method, it returns a new reader
+// of the buffered body on every call.
 func (c *RequestContext) GetBody() io.ReadCloser {
+	if c.bodyRead && c.bodyErr == nil {
+		c.resetBody()
+	}
 	return c.R.Body
 }
 
 // GetRawBody returns the body as a byte array, closing the body reader.
+// The body is buffered on the first call, within the maximum body size, so every subsequent call,
+// GetXObject method or interceptor reads the same body. The returned slice must not be modified.
 func (c *RequestContext) GetRawBody() ([]byte, error) {
+	if c.bodyRead {
+		return c.rawBody, c.bodyErr
+	}
 	body := c.GetBody()
 	defer body.Close()
 	rawBody, err := ioutil.ReadAll(body)
+	c.bodyRead = true
 	if err != nil {
-		return nil, err
+		c.bodyErr = bodyError(err)
+		return nil, c.bodyErr
 	}
+	c.rawBody = rawBody
+	c.resetBody()
 	if debugMode {
-		writeDebug("GetRawBody", c.R.RemoteAddr, fmt.Sprintf("got %s", string(rawBody)))
+		writeDebug("GetRawBody", c.R.RemoteAddr, c.RequestID, fmt.Sprintf("got %s", string(rawBody)))
 	}
 	return rawBody, nil
 }
 
-// GetJSONObject call json.Unmarshal by sending the reference of the given object.
+// resetBody replaces the body of the request by a new reader of the buffered body.
+func (c *RequestContext) resetBody() {
+	c.R.Body = ioutil.NopCloser(bytes.NewReader(c.rawBody))
+}
+
+// GetJSONObject decodes the JSON body into the given object, which must be a pointer, using the options set
+// with Pi.SetJSONDecoding. A 400 *JSONDecodeError is returned if the body cannot be decoded.
+// Once decoded, the object is validated (see Validate) and a 422 *ValidationError is returned if it is invalid.
 // For example:
 //		func GetUser(c *pi.RequestContext) error {
 // 			user := &User{}
 // 			if err := c.GetJSONObject(user); err != nil {
-//				return pi.NewError(400, err)
+//				return err
 //			}
 //			// Do something with the user...
 //			return nil
 //		}
 //
 func (c *RequestContext) GetJSONObject(object interface{}) error {
-	rawBody, err := c.GetRawBody()
-	if err != nil {
+	if err := c.decodeJSONObject(object); err != nil {
 		return err
 	}
-	return json.Unmarshal(rawBody, &object)
+	return validate(object, "json", false)
 }
 
 // GetXMLObject call xml.Unmarshal by sending the reference of the given object.
 func (c *RequestContext) GetXMLObject(object interface{}) error {
-	rawBody, err := c.GetRawBody()
-	if err != nil {
+	if err := c.decodeXMLObject(object); err != nil {
 		return err
 	}
-	return xml.Unmarshal(rawBody, &object)
+	return validate(object, "xml", true)
 }
 
 // GetFormObject call gorilla/schema.Decode to maps the form values of the request into the object.
 // For more information: http://www.gorillatoolkit.org/pkg/schema
 func (c *RequestContext) GetFormObject(object interface{}) error {
-	if err := c.R.ParseForm(); err != nil {
+	if err := c.decodeFormObject(object); err != nil {
 		return err
 	}
-	return decoderFormValues.Decode(object, c.R.PostForm)
+	return validate(object, "schema", false)
 }
 
 // GetMultipartObject calls gocarina/formdata.Unmarshal to maps the multipart form values of the request into the object.
 // It supports files through multipart.FileHeader.
+// Unlike the other GetXObject methods, the body is not buffered, the files being stored on disk when they are large.
+// See GetMultipartStream to process the parts as they are received.
 func (c *RequestContext) GetMultipartObject(object interface{}) error {
-	return formdata.Unmarshal(c.R, object)
+	if err := c.decodeMultipartObject(object); err != nil {
+		return err
+	}
+	return validate(object, "formdata", false)
 }
 
-// GetDefaultObject calls one of a GetX method according to the Content-Type of the request.
-// Content-Types supported:
+// GetDefaultObject decodes the body into the object with the Codec registered on the Pi for the Content-Type
+// of the request (see Pi.RegisterCodec), calling one of a GetX method for the default Codecs.
+// As every GetXObject method, it validates the object once decoded, see Validate.
+// Content-Types supported by default:
 // 		application/json
 //		application/xml
 //		application/x-www-form-urlencoded
 //		multipart/form-data
+//		text/plain
 //
 func (c *RequestContext) GetDefaultObject(object interface{}) error {
-	switch strings.Split(c.GetContentType(), ";")[0] {
-	case ContentTypeJSON:
-		return c.GetJSONObject(object)
-	case ContentTypeXML:
-		return c.GetXMLObject(object)
-	case ContentTypeClassicForm:
-		return c.GetFormObject(object)
+	tagName, err := c.decodeDefaultObject(object)
+	if err != nil {
+		return err
+	}
+	return validate(object, tagName, tagName == "xml")
+}
+
+// decodeJSONObject decodes the JSON body into the object, using the JSON decoding options of the Pi.
+func (c *RequestContext) decodeJSONObject(object interface{}) error {
+	return c.decodeJSONObjectWithOptions(object, c.jsonDecoding())
+}
+
+// decodeXMLObject decodes the XML body into the object.
+func (c *RequestContext) decodeXMLObject(object interface{}) error {
+	rawBody, err := c.GetRawBody()
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(rawBody, &object)
+}
+
+// decodeFormObject decodes the form encoded body into the object.
+func (c *RequestContext) decodeFormObject(object interface{}) error {
+	if c.R.PostForm == nil {
+		if _, err := c.GetRawBody(); err != nil {
+			return err
+		}
+	}
+	if err := c.R.ParseForm(); err != nil {
+		return bodyError(err)
 	}
-	if strings.SplitAfter(c.GetContentType(), ContentTypeMultipart)[0] == ContentTypeMultipart {
-		return c.GetMultipartObject(object)
+	return decoderFormValues.Decode(object, c.R.PostForm)
+}
+
+// decodeMultipartObject decodes the multipart form into the object.
+func (c *RequestContext) decodeMultipartObject(object interface{}) error {
+	if err := c.parseMultipartForm(); err != nil {
+		return err
+	}
+	return formdata.Unmarshal(c.R, object)
+}
+
+// decodeDefaultObject decodes the body into the object with the Codec registered for the Content-Type of the request,
+// returning the name of the struct tag naming the fields in this format.
+func (c *RequestContext) decodeDefaultObject(object interface{}) (tagName string, err error) {
+	codec := c.codecs().get(c.GetContentType())
+	if codec == nil {
+		return "", ErrContentTypeNotSupported
 	}
-	return ErrContentTypeNotSupported
+	return structTag(codec), codec.Decode(c, object)
 }
 
-// GetRouteExtraPath returns the extra path.
+// GetRouteExtraPath returns the extra path, without the query string.
 // For example:
 // 		for route("/files"), "/files/home/user/.emacs" will return "/home/user/.emacs"
 func (c *RequestContext) GetRouteExtraPath() (path string) {
-	fullPath := c.R.URL.String()
+	fullPath := c.R.URL.Path
 	if len(fullPath) > len(c.RouteURL) {
 		path = fullPath[len(c.RouteURL):]
 	}
@@ -263,8 +386,9 @@ func (c *RequestContext) GetRouteExtraPath() (path string) {
 //		fmt.Println(c.GetURLParam("id"))
 //		// Outputs 1234
 //
+// Only the query string is read, the values of a POST form are ignored.
 func (c *RequestContext) GetURLParam(param string) string {
-	return c.R.FormValue(param)
+	return c.R.URL.Query().Get(param)
 }
 
 // GetURLParams returns multiple URL parameter.
@@ -274,9 +398,9 @@ func (c *RequestContext) GetURLParam(param string) string {
 //		fmt.Println(c.GetURLParams("c"))
 //		// Outputs [1, 2]
 //
+// Only the query string is read, the values of a POST form are ignored.
 func (c *RequestContext) GetURLParams(param string) []string {
-	c.R.ParseForm()
-	return c.R.Form[param]
+	return c.R.URL.Query()[param]
 }
 
 // GetURLParamOrDefault returns an URL parameter or the defaultValue if the value is empty.
@@ -289,6 +413,7 @@ func (c *RequestContext) GetURLParamOrDefault(param, defaultValue string) string
 }
 
 // GetURLParamAsInt returns the URL parameter as an int. Ignores error.
+// See GetURLParamInt to get the conversion error.
 func (c *RequestContext) GetURLParamAsInt(param string) int {
 	v, _ := strconv.Atoi(c.GetURLParam(param))
 	return v
@@ -326,17 +451,17 @@ func (c *RequestContext) GetRouteVariable(key string) string {
 //		p.ListenAndServe(":8080")
 //
 func (c *RequestContext) GetFileHeaders(key string) ([]*multipart.FileHeader, error) {
-	if err := c.R.ParseMultipartForm(32 << 20); err != nil {
+	if err := c.parseMultipartForm(); err != nil {
 		return nil, err
 	}
 	if c.R.MultipartForm != nil && c.R.MultipartForm.File[key] != nil {
 		if debugMode {
-			writeDebug("GetFileHeaders", c.R.RemoteAddr, fmt.Sprintf("got %d files from key %s", len(c.R.MultipartForm.File[key]), key))
+			writeDebug("GetFileHeaders", c.R.RemoteAddr, c.RequestID, fmt.Sprintf("got %d files from key %s", len(c.R.MultipartForm.File[key]), key))
 		}
 		return c.R.MultipartForm.File[key], nil
 	}
 	if debugMode {
-		writeDebug("GetFileHeaders", c.R.RemoteAddr, fmt.Sprintf("got 0 files from key %s", key))
+		writeDebug("GetFileHeaders", c.R.RemoteAddr, c.RequestID, fmt.Sprintf("got 0 files from key %s", key))
 	}
 	return nil, ErrNoFiles
 }
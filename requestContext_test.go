@@ -0,0 +1,32 @@
+package pi
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRawBodyIsBuffered(t *testing.T) {
+	p := New()
+	p.Router("/").Post(func(c *RequestContext) error {
+		object := map[string]string{}
+		if err := c.GetJSONObject(&object); err != nil {
+			return err
+		}
+		return c.WriteString(object["name"])
+	}).Before(func(c *RequestContext) error {
+		rawBody, err := c.GetRawBody()
+		if err != nil || len(rawBody) == 0 {
+			return NewError(401, fmt.Errorf("unauthorized"))
+		}
+		return nil
+	})
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"name": "pi"}`)))
+	if w.Body.String() != "pi" {
+		t.Fatalf("expected the body to be readable after the Before interceptor, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,80 @@
+package pi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// HeaderRequestID is the header used to receive and propagate the request ID.
+var HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength is the maximum length of a request ID accepted from a client.
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+// RequestIDInterceptor returns a Before interceptor that assigns an ID to every request.
+// The ID sent by the client in the X-Request-ID header is kept if it is valid, otherwise
+// a new one is created with the generator, or a random one if the generator is nil.
+// The ID is stored in RequestContext.RequestID, echoed in the response headers, written
+// in the debug output and in the body of the errors created with NewError and NewXMLError.
+// For example:
+//		p := pi.New()
+//		p.Router("/", ...).Before(pi.RequestIDInterceptor(nil))
+//
+func RequestIDInterceptor(generator func() string) HandlerFunction {
+	if generator == nil {
+		generator = generateRequestID
+	}
+	return func(c *RequestContext) error {
+		requestID := c.GetHeader(HeaderRequestID)
+		if !isValidRequestID(requestID) {
+			requestID = generator()
+		}
+		c.RequestID = requestID
+		c.R = c.R.WithContext(context.WithValue(c.R.Context(), requestIDContextKey{}, requestID))
+		c.SetHeader(HeaderRequestID, requestID)
+		return nil
+	}
+}
+
+// RequestIDFromContext returns the request ID stored in the context by RequestIDInterceptor,
+// or an empty string. It is useful to propagate the ID to the services called by the handler.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// SetRequestIDHeader sets the request ID stored in the context to the headers of an outgoing request.
+func SetRequestIDHeader(ctx context.Context, header http.Header) {
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		header.Set(HeaderRequestID, requestID)
+	}
+}
+
+// generateRequestID returns a random 128 bits request ID, hex encoded.
+func generateRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// isValidRequestID checks that a request ID received from a client is safe to be logged and echoed.
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':', r == '+', r == '/', r == '=', r == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package pi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDInterceptor(t *testing.T) {
+	p := New()
+	p.Router("/",
+		p.Route("/error").Get(func(c *RequestContext) error {
+			return NewError(400, fmt.Errorf("bad request"))
+		}),
+	).Get(func(c *RequestContext) error {
+		return c.WriteString(c.RequestID)
+	}).Before(RequestIDInterceptor(func() string { return "generated" }))
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "generated" || w.Header().Get(HeaderRequestID) != "generated" {
+		t.Fatalf("expected a generated request ID, got %q (header %q)", w.Body.String(), w.Header().Get(HeaderRequestID))
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(HeaderRequestID, "client-id")
+	p.ServeHTTP(w, r)
+	if w.Body.String() != "client-id" {
+		t.Fatalf("expected the client request ID, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(HeaderRequestID, "<script>")
+	p.ServeHTTP(w, r)
+	if w.Body.String() != "generated" {
+		t.Fatalf("expected an invalid request ID to be replaced, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/error", nil)
+	r.Header.Set(HeaderRequestID, "client-id")
+	p.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"requestId": "client-id"`) {
+		t.Fatalf("expected the request ID in the error body, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRequestIDIsEscapedInXMLErrors(t *testing.T) {
+	p := New()
+	p.Router("/").Get(func(c *RequestContext) error {
+		return NewXMLError(400, fmt.Errorf("bad request"))
+	}).Before(RequestIDInterceptor(func() string { return `a"<b>` }))
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if expected := `<error code="400" requestId="a&#34;&lt;b&gt;">bad request</error>`; w.Body.String() != expected {
+		t.Errorf("expected %s, got %s", expected, w.Body.String())
+	}
+}
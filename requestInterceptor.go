@@ -79,7 +79,7 @@ func (i *interceptors) runRecovererInterceptors(c *RequestContext, recoverValue
 func (i *interceptors) runErrorInterceptors(c *RequestContext, err error) (returnError error) {
 	for _, e := range i.Error {
 		if err := e(c, err); err != nil {
-			fmt.Sprintln(os.Stderr, "error interceptor raised error:", err)
+			fmt.Fprintln(os.Stderr, "error interceptor raised error:", err)
 			returnError = err
 		}
 	}
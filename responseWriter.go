@@ -0,0 +1,75 @@
+package pi
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// statusCodeWriter is implemented by the ResponseWriters keeping track of the status code.
+type statusCodeWriter interface {
+	writtenStatusCode() int
+}
+
+// responseWriter wraps the http.ResponseWriter of a request to keep track of the status code
+// and of the number of bytes written.
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	written    int64
+}
+
+// newResponseWriter returns a new responseWriter.
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+// WriteHeader records the status code and sends it to the underlying ResponseWriter.
+func (w *responseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write writes the data to the underlying ResponseWriter, recording an implicit 200 status code.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Flush sends any buffered data to the client, if the underlying ResponseWriter supports it.
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, if the underlying ResponseWriter supports it.
+// A hijacked connection is recorded as switching protocols, as for a WebSocket handshake.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the ResponseWriter does not implement http.Hijacker")
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err == nil && w.statusCode == 0 {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, buffer, err
+}
+
+// Unwrap returns the underlying ResponseWriter, see http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writtenStatusCode returns the status code sent to the client, or 0 if nothing has been sent yet.
+func (w *responseWriter) writtenStatusCode() int {
+	return w.statusCode
+}
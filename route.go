@@ -9,6 +9,9 @@ type Route struct {
 	ChildRoutes  routes
 	Methods      map[string]HandlerFunction
 	Interceptors interceptors
+	cors         *CORS
+	maxBodySize  int64
+	produces     []string
 }
 
 type routes []*Route
@@ -0,0 +1,190 @@
+package pi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ContentTypeEventStream is the default MIME for Server-Sent Events.
+	ContentTypeEventStream = "text/event-stream"
+
+	// HeaderLastEventID is the header sent by the clients reconnecting to a Server-Sent Events stream.
+	HeaderLastEventID = "Last-Event-ID"
+
+	// ErrEventStreamClosed is the error when sending to a Server-Sent Events stream once the request is handled.
+	ErrEventStreamClosed = fmt.Errorf("event stream closed")
+
+	// ErrInvalidEventField is the error when the event name or the ID of a Server-Sent Event contains a newline.
+	ErrInvalidEventField = fmt.Errorf("event name and ID cannot contain newlines")
+)
+
+// EventStream is a Server-Sent Events stream, see RequestContext.SSE.
+// Its methods are safe for concurrent use.
+type EventStream struct {
+	c           *RequestContext
+	w           http.ResponseWriter
+	controller  *http.ResponseController
+	mutex       sync.Mutex
+	closed      bool
+	lastEventID string
+}
+
+// SSE starts a Server-Sent Events stream (text/event-stream) on the response: the headers are sent
+// with a 200 status code, the write deadline of the server is removed so the stream can outlive
+// the WriteTimeout, and every event is flushed to the client.
+// The stream is closed once the request is handled, and every send fails with the error of the
+// context of the request once the client is gone, so handlers can stop on the first error.
+// For example:
+//		func JobProgress(c *pi.RequestContext) error {
+//			stream, err := c.SSE()
+//			if err != nil {
+//				return err
+//			}
+//			defer stream.Heartbeat(15 * time.Second)()
+//			for progress := range job.Progress(stream.LastEventID()) {
+//				if err := stream.Send("progress", progress.ID, progress); err != nil {
+//					return err
+//				}
+//			}
+//			return nil
+//		}
+//
+func (c *RequestContext) SSE() (*EventStream, error) {
+	stream := &EventStream{
+		c:           c,
+		w:           c.W,
+		controller:  http.NewResponseController(c.W),
+		lastEventID: c.GetHeader(HeaderLastEventID),
+	}
+	if err := stream.controller.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, err
+	}
+	header := c.W.Header()
+	header.Set("Content-Type", ContentTypeEventStream+"; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	header.Del("Content-Length")
+	c.W.WriteHeader(http.StatusOK)
+	if err := stream.controller.Flush(); err != nil {
+		return nil, err
+	}
+	c.OnFinish(stream.close)
+	return stream, nil
+}
+
+// LastEventID returns the ID of the last event received by the client, sent in the Last-Event-ID header
+// when it reconnects, so the stream can resume after it. It is empty on the first connection.
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done returns a channel closed when the client is gone.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.c.R.Context().Done()
+}
+
+// Send sends an event to the client. The event name and the ID are optional.
+// The data is written as is if it is a string or a []byte, otherwise it is marshalled to JSON.
+// Multiline data is sent as multiple data lines.
+func (s *EventStream) Send(event, id string, data interface{}) error {
+	if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n") {
+		return ErrInvalidEventField
+	}
+	var payload string
+	switch data := data.(type) {
+	case string:
+		payload = data
+	case []byte:
+		payload = string(data)
+	default:
+		output, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = string(output)
+	}
+	message := &strings.Builder{}
+	if id != "" {
+		fmt.Fprintf(message, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(message, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(payload), "\n") {
+		fmt.Fprintf(message, "data: %s\n", line)
+	}
+	message.WriteString("\n")
+	return s.write(message.String())
+}
+
+// Retry tells the client how long to wait before reconnecting once the connection is lost.
+func (s *EventStream) Retry(delay time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(delay.Milliseconds(), 10) + "\n\n")
+}
+
+// Comment sends a comment, ignored by the clients but keeping the connection alive.
+func (s *EventStream) Comment(text string) error {
+	message := &strings.Builder{}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(message, ": %s\n", line)
+	}
+	message.WriteString("\n")
+	return s.write(message.String())
+}
+
+// Heartbeat sends a comment every interval, so the proxies do not close an idle connection,
+// until the returned function is called, the client is gone or the request is handled.
+func (s *EventStream) Heartbeat(interval time.Duration) (stop func()) {
+	stopped := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Comment("heartbeat"); err != nil {
+					return
+				}
+			case <-stopped:
+				return
+			case <-s.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() { close(stopped) })
+	}
+}
+
+// write writes the message to the client and flushes it.
+func (s *EventStream) write(message string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrEventStreamClosed
+	}
+	if err := s.c.R.Context().Err(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(s.w, message); err != nil {
+		return err
+	}
+	return s.controller.Flush()
+}
+
+// close closes the stream once the request is handled, the following sends failing.
+func (s *EventStream) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+}
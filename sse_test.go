@@ -0,0 +1,77 @@
+package pi
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	var stream *EventStream
+	p := New()
+	p.Router("/events").Get(func(c *RequestContext) error {
+		var err error
+		stream, err = c.SSE()
+		if err != nil {
+			return err
+		}
+		stream.Retry(3 * time.Second)
+		stream.Send("progress", "2", J{"percent": 50})
+		stream.Send("", "", "multi\nline")
+		stream.Comment("still there")
+		return stream.Send("done", "3", []byte("ok"))
+	})
+	p.Construct()
+
+	r := httptest.NewRequest("GET", "/events", nil)
+	r.Header.Set(HeaderLastEventID, "1")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	expected := "retry: 3000\n\n" +
+		"id: 2\nevent: progress\ndata: {\"percent\":50}\n\n" +
+		"data: multi\ndata: line\n\n" +
+		": still there\n\n" +
+		"id: 3\nevent: done\ndata: ok\n\n"
+	if w.Code != 200 || w.Header().Get("Content-Type") != "text/event-stream; charset=utf-8" || w.Body.String() != expected {
+		t.Errorf("expected %q, got %d %q (%s)", expected, w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+	if stream.LastEventID() != "1" {
+		t.Errorf("expected the last event ID 1, got %q", stream.LastEventID())
+	}
+	if err := stream.Send("late", "", "data"); err != ErrEventStreamClosed {
+		t.Errorf("expected ErrEventStreamClosed once the request is handled, got %v", err)
+	}
+	if err := stream.Send("invalid\nevent", "", "data"); err != ErrInvalidEventField {
+		t.Errorf("expected ErrInvalidEventField, got %v", err)
+	}
+}
+
+func TestSSEHeartbeatAndDisconnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var sendErr error
+	p := New()
+	p.Router("/events").Get(func(c *RequestContext) error {
+		stream, err := c.SSE()
+		if err != nil {
+			return err
+		}
+		defer stream.Heartbeat(5 * time.Millisecond)()
+		time.Sleep(30 * time.Millisecond)
+		cancel()
+		<-stream.Done()
+		sendErr = stream.Send("progress", "", "lost")
+		return nil
+	})
+	p.Construct()
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+	if !strings.HasPrefix(w.Body.String(), ": heartbeat\n\n") || strings.Contains(w.Body.String(), "lost") {
+		t.Errorf("expected heartbeats only, got %q", w.Body.String())
+	}
+	if sendErr != context.Canceled {
+		t.Errorf("expected context.Canceled once the client is gone, got %v", sendErr)
+	}
+}
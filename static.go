@@ -0,0 +1,200 @@
+package pi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrFileNotFound is the error when the file requested to a StaticHandler does not exist.
+var ErrFileNotFound = fmt.Errorf("file not found")
+
+// Static configures a StaticHandler.
+type Static struct {
+	// Index is the file served for the directories, index.html if empty.
+	Index string
+
+	// Browse lists the content of the directories without index file, instead of replying 404.
+	Browse bool
+
+	// Precompressed serves the gzip compressed sibling of a file, for example app.js.gz for app.js,
+	// to the clients accepting gzip.
+	Precompressed bool
+
+	// Fallback is the file served instead of replying 404 when the requested path has no extension,
+	// for example index.html for a single page application handling its own routes.
+	Fallback string
+
+	// CacheControl is the Cache-Control header of the files served, if not empty.
+	CacheControl string
+}
+
+// directoryListingTemplate is the template of the directory listings.
+var directoryListingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Path}}</title></head><body>
+<h1>{{.Path}}</h1>
+<ul>
+{{range .Entries}}<li><a href="{{.}}">{{.}}</a></li>
+{{end}}</ul>
+</body></html>
+`))
+
+// StaticHandler returns a HandlerFunction serving the files of the file system, for example an embed.FS or os.DirFS,
+// under the route, using the extra path of the request (see GetRouteExtraPath) as the path of the file.
+// The path is cleaned so no file outside of the file system can be served. The files are served
+// with http.ServeContent, handling Range requests and conditional requests with ETag and Last-Modified.
+// If static is nil, the default configuration is used.
+// For example:
+//		//go:embed public
+//		var public embed.FS
+//
+//		assets, _ := fs.Sub(public, "public")
+//		p.Router("/app").Get(pi.StaticHandler(assets, &pi.Static{Fallback: "index.html", Precompressed: true}))
+//
+func StaticHandler(fsys fs.FS, static *Static) HandlerFunction {
+	if static == nil {
+		static = &Static{}
+	}
+	index := static.Index
+	if index == "" {
+		index = "index.html"
+	}
+	return func(c *RequestContext) error {
+		requestPath := path.Clean("/" + c.GetRouteExtraPath())
+		name := strings.TrimPrefix(requestPath, "/")
+		if name == "" {
+			name = "."
+		}
+		info, err := fs.Stat(fsys, name)
+		if err == nil && info.IsDir() {
+			if !strings.HasSuffix(c.R.URL.Path, "/") {
+				return redirectToDirectory(c)
+			}
+			if indexInfo, err := fs.Stat(fsys, path.Join(name, index)); err == nil && !indexInfo.IsDir() {
+				return static.serveFile(c, fsys, path.Join(name, index), indexInfo)
+			}
+			if static.Browse {
+				return listDirectory(c, fsys, name, requestPath)
+			}
+			return NewDefaultError(http.StatusNotFound, ErrFileNotFound)
+		}
+		if errors.Is(err, fs.ErrNotExist) && static.Fallback != "" && path.Ext(requestPath) == "" {
+			name = static.Fallback
+			info, err = fs.Stat(fsys, name)
+		}
+		if err != nil {
+			return fileError(err)
+		}
+		if info.IsDir() {
+			return NewDefaultError(http.StatusNotFound, ErrFileNotFound)
+		}
+		return static.serveFile(c, fsys, name, info)
+	}
+}
+
+// serveFile serves the file, or its gzip compressed sibling if the client accepts it.
+func (static *Static) serveFile(c *RequestContext, fsys fs.FS, name string, info fs.FileInfo) error {
+	if static.CacheControl != "" {
+		c.SetHeader("Cache-Control", static.CacheControl)
+	}
+	served, servedInfo := name, info
+	if static.Precompressed {
+		if gzipInfo, err := fs.Stat(fsys, name+".gz"); err == nil && !gzipInfo.IsDir() {
+			c.addVary("Accept-Encoding")
+			if acceptsGzip(c.GetHeader("Accept-Encoding")) {
+				contentType := mime.TypeByExtension(path.Ext(name))
+				if contentType == "" {
+					contentType = "application/octet-stream"
+				}
+				c.SetHeader("Content-Type", contentType)
+				c.SetHeader("Content-Encoding", "gzip")
+				served, servedInfo = name+".gz", gzipInfo
+			}
+		}
+	}
+	file, err := fsys.Open(served)
+	if err != nil {
+		return fileError(err)
+	}
+	defer file.Close()
+	content, ok := file.(io.ReadSeeker)
+	if !ok {
+		data, err := ioutil.ReadAll(file)
+		if err != nil {
+			return err
+		}
+		content = bytes.NewReader(data)
+	}
+	if c.W.Header().Get("ETag") == "" {
+		c.SetHeader("ETag", fileETag(servedInfo))
+	}
+	c.ServeContent(name, servedInfo.ModTime(), content)
+	return nil
+}
+
+// fileETag returns a weak ETag derived from the size and the modification time of the file.
+func fileETag(info fs.FileInfo) string {
+	return `W/"` + strconv.FormatInt(info.Size(), 36) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 36) + `"`
+}
+
+// acceptsGzip checks if the Accept-Encoding header accepts gzip.
+func acceptsGzip(acceptEncoding string) bool {
+	return (&Compression{Encodings: []string{"gzip"}}).negotiate(acceptEncoding) == "gzip"
+}
+
+// redirectToDirectory redirects the request to the path with a trailing slash, so relative links resolve
+// inside the directory.
+func redirectToDirectory(c *RequestContext) error {
+	location := path.Base(c.R.URL.Path) + "/"
+	if c.R.URL.RawQuery != "" {
+		location += "?" + c.R.URL.RawQuery
+	}
+	http.Redirect(c.W, c.R, location, http.StatusMovedPermanently)
+	return nil
+}
+
+// listDirectory writes the HTML listing of the directory.
+func listDirectory(c *RequestContext, fsys fs.FS, name, requestPath string) error {
+	entries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return fileError(err)
+	}
+	listing := struct {
+		Path    string
+		Entries []string
+	}{Path: requestPath}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			listing.Entries = append(listing.Entries, entry.Name()+"/")
+		} else {
+			listing.Entries = append(listing.Entries, entry.Name())
+		}
+	}
+	buffer := &bytes.Buffer{}
+	if err := directoryListingTemplate.Execute(buffer, listing); err != nil {
+		return err
+	}
+	c.SetHeader("Content-Type", "text/html; charset=utf-8")
+	_, err = buffer.WriteTo(c.W)
+	return err
+}
+
+// fileError converts the errors of the file system to 404 and 403 HTTPErrors.
+func fileError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewDefaultError(http.StatusNotFound, ErrFileNotFound)
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return NewDefaultError(http.StatusForbidden, err, PublicMessage(http.StatusText(http.StatusForbidden)))
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package pi
+
+import (
+	"io/fs"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestStaticHandler(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte("<h1>home</h1>"), ModTime: modTime},
+		"app.js":         {Data: []byte("console.log('app')"), ModTime: modTime},
+		"app.js.gz":      {Data: []byte("gzipped"), ModTime: modTime},
+		"docs/guide.txt": {Data: []byte("guide"), ModTime: modTime},
+		"docs/<b>.txt":   {Data: []byte("escaped"), ModTime: modTime},
+	}
+	p := New()
+	p.Router("/app").Get(StaticHandler(fsys, &Static{Precompressed: true, Fallback: "index.html", CacheControl: "max-age=60"}))
+	p.Router("/files").Get(StaticHandler(fsys, &Static{Browse: true}))
+	p.Construct()
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		code           int
+		body           string
+		header         string
+		value          string
+	}{
+		{"/app/", "", 200, "<h1>home</h1>", "Cache-Control", "max-age=60"},
+		{"/app", "", 301, "", "Location", "/app/"},
+		{"/app/app.js", "", 200, "console.log('app')", "Vary", "Accept-Encoding"},
+		{"/app/app.js", "gzip, deflate", 200, "gzipped", "Content-Encoding", "gzip"},
+		{"/app/app.js", "gzip;q=0", 200, "console.log('app')", "Content-Encoding", ""},
+		{"/app/users/42", "", 200, "<h1>home</h1>", "Content-Type", "text/html; charset=utf-8"},
+		{"/app/missing.png", "", 404, `{"errorCode": 404, "errorMessage": "file not found"}`, "", ""},
+		{"/files/docs/guide.txt?download=1", "", 200, "guide", "Content-Type", "text/plain; charset=utf-8"},
+		{"/files/docs", "", 301, "", "Location", "/files/docs/"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		if w.Code != test.code || (test.code != 301 && w.Body.String() != test.body) || (test.header != "" && w.Header().Get(test.header) != test.value) {
+			t.Errorf("%s: expected %d %q with %s: %q, got %d %q with %q", test.path, test.code, test.body, test.header, test.value, w.Code, w.Body.String(), w.Header().Get(test.header))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/files/docs/", nil))
+	if body := w.Body.String(); w.Code != 200 || !strings.Contains(body, `<a href="guide.txt">guide.txt</a>`) || !strings.Contains(body, "&lt;b&gt;.txt") {
+		t.Errorf("expected the listing of docs, got %d %s", w.Code, body)
+	}
+
+	// The router cleans the paths, the handler must clean them too when called directly.
+	for path, expected := range map[string]string{"/app/../../etc/passwd": "<h1>home</h1>", "/app/docs/../app.js": "console.log('app')"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL.Path = path
+		w := httptest.NewRecorder()
+		StaticHandler(fsys, &Static{Fallback: "index.html"})(newRequestContext(newResponseWriter(w), r, "/app"))
+		if w.Body.String() != expected {
+			t.Errorf("%s: expected %q, got %d %q", path, expected, w.Code, w.Body.String())
+		}
+	}
+
+	info, err := fs.Stat(fsys, "app.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/app/app.js", nil)
+	r.Header.Set("If-None-Match", fileETag(info))
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != 304 {
+		t.Errorf("expected 304 for a matching ETag, got %d", w.Code)
+	}
+}
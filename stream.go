@@ -0,0 +1,199 @@
+package pi
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+var (
+	// ContentTypeNDJSON is the default MIME for newline delimited JSON, or JSON Lines.
+	ContentTypeNDJSON = "application/x-ndjson"
+
+	// StreamFlushCount is the number of objects after which a stream is flushed to the client.
+	StreamFlushCount = 100
+
+	// StreamFlushInterval is the duration after which a stream is flushed to the client,
+	// checked every time an object is written.
+	StreamFlushInterval = time.Second
+
+	// ErrXMLRootName is the error returned by WriteXMLStream when the name of the root element is not a valid XML name.
+	ErrXMLRootName = fmt.Errorf("invalid name of the XML root element")
+)
+
+// streamBufferSize is the size of the buffer of the streams, flushed to the client when full.
+const streamBufferSize = 32 * 1024
+
+// StreamIterator returns the next object of a stream, false once there are no more objects,
+// or an error interrupting the stream.
+type StreamIterator func() (object interface{}, ok bool, err error)
+
+// IterateChannel returns a StreamIterator over the values received from a channel, until it is closed
+// or the context is done, usually the context of the request so the stream stops when the client disconnects.
+// It panics if channel is not a channel.
+// For example:
+//		rows := make(chan Row)
+//		go exportRows(rows)
+//		return c.WriteJSONStream(pi.IterateChannel(c.R.Context(), rows))
+//
+func IterateChannel(ctx context.Context, channel interface{}) StreamIterator {
+	value := reflect.ValueOf(channel)
+	if value.Kind() != reflect.Chan {
+		panic(fmt.Sprintf("pi: IterateChannel called with a %T", channel))
+	}
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: value},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	}
+	return func() (interface{}, bool, error) {
+		chosen, received, ok := reflect.Select(cases)
+		if chosen == 1 {
+			return nil, false, ctx.Err()
+		}
+		if !ok {
+			return nil, false, nil
+		}
+		return received.Interface(), true, nil
+	}
+}
+
+// IterateSlice returns a StreamIterator over the elements of a slice or an array.
+// It panics if slice is not a slice or an array.
+func IterateSlice(slice interface{}) StreamIterator {
+	value := reflect.ValueOf(slice)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		panic(fmt.Sprintf("pi: IterateSlice called with a %T", slice))
+	}
+	i := 0
+	return func() (interface{}, bool, error) {
+		if i >= value.Len() {
+			return nil, false, nil
+		}
+		i++
+		return value.Index(i - 1).Interface(), true, nil
+	}
+}
+
+// WriteJSONStream writes the objects of the iterator as a JSON array, encoding them one by one
+// instead of marshalling the whole array in memory. The stream is flushed to the client
+// every StreamFlushCount objects or StreamFlushInterval.
+// If the iterator returns an error before anything has been flushed, the error is returned and written
+// as any other error. Once the stream has been flushed, the status code cannot change anymore:
+// the error is returned to the Error interceptors and the array is left unterminated, so the client
+// cannot mistake the truncated response for a complete one.
+// For example:
+//		func ExportUsers(c *pi.RequestContext) error {
+//			rows, err := db.Query("SELECT id, name FROM users")
+//			if err != nil {
+//				return err
+//			}
+//			defer rows.Close()
+//			return c.WriteJSONStream(func() (interface{}, bool, error) {
+//				if !rows.Next() {
+//					return nil, false, rows.Err()
+//				}
+//				user := User{}
+//				return user, true, rows.Scan(&user.ID, &user.Name)
+//			})
+//		}
+//
+func (c *RequestContext) WriteJSONStream(iterator StreamIterator) error {
+	return c.writeStream("WriteJSONStream", "application/json; charset=utf-8", "[", ",", "]", func(w io.Writer, object interface{}) error {
+		output, err := json.Marshal(object)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	}, iterator)
+}
+
+// WriteJSONLines writes the objects of the iterator as newline delimited JSON (application/x-ndjson),
+// one object per line. It is flushed and handles the errors like WriteJSONStream: once the stream has been
+// flushed, an error stops the stream after the last complete line.
+func (c *RequestContext) WriteJSONLines(iterator StreamIterator) error {
+	return c.writeStream("WriteJSONLines", ContentTypeNDJSON+"; charset=utf-8", "", "", "", func(w io.Writer, object interface{}) error {
+		return json.NewEncoder(w).Encode(object)
+	}, iterator)
+}
+
+// WriteXMLStream writes the objects of the iterator as XML elements, children of a root element
+// named rootName. It is flushed and handles the errors like WriteJSONStream: once the stream has been
+// flushed, an error leaves the root element unclosed. ErrXMLRootName is returned before anything is written
+// if rootName is not a valid XML name.
+// For example:
+//		return c.WriteXMLStream("users", pi.IterateSlice(users))
+//		// Output: <users><User>...</User><User>...</User></users>
+//
+func (c *RequestContext) WriteXMLStream(rootName string, iterator StreamIterator) error {
+	if !isXMLName(rootName) {
+		return ErrXMLRootName
+	}
+	return c.writeStream("WriteXMLStream", "application/xml; charset=utf-8", "<"+rootName+">", "", "</"+rootName+">", func(w io.Writer, object interface{}) error {
+		return xml.NewEncoder(w).Encode(object)
+	}, iterator)
+}
+
+// writeStream writes the objects of the iterator encoded one by one, between the opening and closing strings
+// and separated by the separator, flushing the stream to the client periodically.
+// The objects are buffered until the first flush, so an error before discards the stream.
+func (c *RequestContext) writeStream(name, contentType, opening, separator, closing string, encode func(io.Writer, interface{}) error, iterator StreamIterator) error {
+	c.W.Header().Set("Content-Type", contentType)
+	buffer := bufio.NewWriterSize(c.W, streamBufferSize)
+	buffer.WriteString(opening)
+	count := 0
+	lastFlush := time.Now()
+	for {
+		if err := c.R.Context().Err(); err != nil {
+			return err
+		}
+		object, ok, err := iterator()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if count > 0 {
+			buffer.WriteString(separator)
+		}
+		if err := encode(buffer, object); err != nil {
+			return err
+		}
+		count++
+		if count%StreamFlushCount == 0 || time.Since(lastFlush) >= StreamFlushInterval {
+			if err := c.flushStream(buffer); err != nil {
+				return err
+			}
+			lastFlush = time.Now()
+		}
+	}
+	buffer.WriteString(closing)
+	if debugMode {
+		writeDebug(name, c.R.RemoteAddr, c.RequestID, fmt.Sprintf("%d objects", count))
+	}
+	return c.flushStream(buffer)
+}
+
+// flushStream sends the buffered stream to the client.
+func (c *RequestContext) flushStream(buffer *bufio.Writer) error {
+	if err := buffer.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := c.W.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// committed returns true if the status code of the response has already been written.
+func (c *RequestContext) committed() bool {
+	w, ok := c.W.(statusCodeWriter)
+	return ok && w.writtenStatusCode() != 0
+}
@@ -0,0 +1,132 @@
+package pi
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type streamedUser struct {
+	XMLName xml.Name `json:"-" xml:"user"`
+	ID      int      `json:"id" xml:"id,attr"`
+}
+
+func TestWriteStream(t *testing.T) {
+	users := []streamedUser{{ID: 1}, {ID: 2}, {ID: 3}}
+	tests := []struct {
+		handler     HandlerFunction
+		contentType string
+		expected    string
+	}{
+		{func(c *RequestContext) error {
+			return c.WriteJSONStream(IterateSlice(users))
+		}, "application/json; charset=utf-8", `[{"id":1},{"id":2},{"id":3}]`},
+		{func(c *RequestContext) error {
+			return c.WriteJSONStream(IterateSlice([]int{}))
+		}, "application/json; charset=utf-8", `[]`},
+		{func(c *RequestContext) error {
+			channel := make(chan streamedUser)
+			go func() {
+				for _, user := range users {
+					channel <- user
+				}
+				close(channel)
+			}()
+			return c.WriteJSONLines(IterateChannel(c.R.Context(), channel))
+		}, "application/x-ndjson; charset=utf-8", "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"},
+		{func(c *RequestContext) error {
+			return c.WriteXMLStream("users", IterateSlice(users))
+		}, "application/xml; charset=utf-8", `<users><user id="1"></user><user id="2"></user><user id="3"></user></users>`},
+	}
+	for _, test := range tests {
+		p := New()
+		p.Router("/").Get(test.handler)
+		p.Construct()
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != 200 || w.Header().Get("Content-Type") != test.contentType || w.Body.String() != test.expected {
+			t.Errorf("expected %s (%s), got %d %s (%s)", test.expected, test.contentType, w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestWriteStreamError(t *testing.T) {
+	defer func(flushCount int) { StreamFlushCount = flushCount }(StreamFlushCount)
+	StreamFlushCount = 2
+	failingIterator := func(failAfter int) StreamIterator {
+		i := 0
+		return func() (interface{}, bool, error) {
+			if i == failAfter {
+				return nil, false, fmt.Errorf("connection lost")
+			}
+			i++
+			return streamedUser{ID: i}, true, nil
+		}
+	}
+	tests := []struct {
+		failAfter int
+		code      int
+		expected  string
+	}{
+		{1, 503, `{"errorCode": 503, "errorMessage": "export failed"}`},
+		{3, 200, `[{"id":1},{"id":2}`},
+	}
+	for _, test := range tests {
+		failAfter := test.failAfter
+		var intercepted error
+		p := New()
+		p.Router("/").Get(func(c *RequestContext) error {
+			if err := c.WriteJSONStream(failingIterator(failAfter)); err != nil {
+				return NewError(503, err, PublicMessage("export failed"))
+			}
+			return nil
+		}).Error(func(c *RequestContext, err error) error {
+			intercepted = err
+			return nil
+		})
+		p.Construct()
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != test.code || w.Body.String() != test.expected {
+			t.Errorf("expected %d %s, got %d %s", test.code, test.expected, w.Code, w.Body.String())
+		}
+		if intercepted == nil || ErrorCause(intercepted).Error() != "connection lost" {
+			t.Errorf("expected the Error interceptors to receive the stream error, got %v", intercepted)
+		}
+	}
+}
+
+func TestWriteXMLStreamRootName(t *testing.T) {
+	for _, rootName := range []string{"", "users><script", "a b", "1users", "xml-users"} {
+		w := httptest.NewRecorder()
+		c := newRequestContext(w, httptest.NewRequest("GET", "/", nil), "/")
+		if err := c.WriteXMLStream(rootName, IterateSlice([]int{1})); err != ErrXMLRootName {
+			t.Errorf("expected ErrXMLRootName for %q, got %v", rootName, err)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("expected nothing to be written for %q, got %s", rootName, w.Body.String())
+		}
+	}
+}
+
+func TestIterateChannelCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	iterator := IterateChannel(ctx, make(chan int))
+	done := make(chan error)
+	go func() {
+		_, _, err := iterator()
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the iterator is still blocked after the context was canceled")
+	}
+}
@@ -0,0 +1,293 @@
+package pi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// HeaderTraceParent is the W3C Trace Context header carrying the parent span.
+	HeaderTraceParent = "traceparent"
+
+	// HeaderTraceState is the W3C Trace Context header carrying vendor specific trace data.
+	HeaderTraceState = "tracestate"
+
+	// ErrInvalidTraceParent is the error when a traceparent header cannot be parsed.
+	ErrInvalidTraceParent = fmt.Errorf("invalid traceparent")
+)
+
+type spanContextKey struct{}
+
+// SpanContext identifies a span in a trace, as propagated by the W3C traceparent header.
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Sampled    bool
+	TraceState string
+}
+
+// IsValid returns true if the trace ID and the span ID are set.
+func (s SpanContext) IsValid() bool {
+	return s.TraceID != [16]byte{} && s.SpanID != [8]byte{}
+}
+
+// TraceParent returns the SpanContext formatted as a traceparent header value.
+func (s SpanContext) TraceParent() string {
+	flags := 0
+	if s.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(s.TraceID[:]), hex.EncodeToString(s.SpanID[:]), flags)
+}
+
+// ParseTraceParent parses a traceparent header value, see https://www.w3.org/TR/trace-context/.
+func ParseTraceParent(traceParent string) (spanContext SpanContext, err error) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return spanContext, ErrInvalidTraceParent
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return spanContext, ErrInvalidTraceParent
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(spanContext.TraceID[:], []byte(parts[1])); err != nil {
+		return spanContext, ErrInvalidTraceParent
+	}
+	if _, err := hex.Decode(spanContext.SpanID[:], []byte(parts[2])); err != nil {
+		return spanContext, ErrInvalidTraceParent
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return spanContext, ErrInvalidTraceParent
+	}
+	if !spanContext.IsValid() {
+		return SpanContext{}, ErrInvalidTraceParent
+	}
+	spanContext.Sampled = flags[0]&1 == 1
+	return spanContext, nil
+}
+
+// SpanContextFromContext returns the SpanContext of the span handling the request, or an invalid SpanContext.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	spanContext, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return spanContext
+}
+
+// SetTraceParentHeader sets the SpanContext stored in the context to the headers of an outgoing request,
+// so the called service continues the trace.
+func SetTraceParentHeader(ctx context.Context, header http.Header) {
+	spanContext := SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return
+	}
+	header.Set(HeaderTraceParent, spanContext.TraceParent())
+	if spanContext.TraceState != "" {
+		header.Set(HeaderTraceState, spanContext.TraceState)
+	}
+}
+
+// Span represents a timed operation of a trace.
+type Span interface {
+	// SpanContext returns the identifiers of the span.
+	SpanContext() SpanContext
+	// SetAttribute sets an attribute describing the operation.
+	SetAttribute(key string, value interface{})
+	// End ends the span, err being the error of the operation, if any.
+	End(err error)
+}
+
+// Tracer starts spans. The span is the root of a new trace if the parent SpanContext is not valid.
+// Pi uses the Tracer set with Pi.SetTracer to open a span for the request, one for each phase of
+// interceptors of each route, and one for the handler.
+type Tracer interface {
+	StartSpan(parent SpanContext, name string) Span
+}
+
+// SpanData is the data of an ended span, as received by a SpanExporter.
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Start       time.Time
+	End         time.Time
+	Attributes  map[string]interface{}
+	Err         error
+}
+
+// Duration returns the duration of the span.
+func (s SpanData) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// SpanExporter receives the spans ended by a Tracer created with NewTracer.
+type SpanExporter interface {
+	ExportSpan(span SpanData)
+}
+
+// NewTracer returns a Tracer generating random identifiers and sending the ended spans to the exporter.
+func NewTracer(exporter SpanExporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter SpanExporter
+}
+
+func (t *tracer) StartSpan(parent SpanContext, name string) Span {
+	spanContext := SpanContext{Sampled: true}
+	if parent.IsValid() {
+		spanContext.TraceID = parent.TraceID
+		spanContext.Sampled = parent.Sampled
+		spanContext.TraceState = parent.TraceState
+	} else {
+		rand.Read(spanContext.TraceID[:])
+	}
+	rand.Read(spanContext.SpanID[:])
+	return &span{
+		exporter: t.exporter,
+		data: SpanData{
+			Name:        name,
+			SpanContext: spanContext,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  make(map[string]interface{}),
+		},
+	}
+}
+
+type span struct {
+	exporter SpanExporter
+	mutex    sync.Mutex
+	ended    bool
+	data     SpanData
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data.Attributes[key] = value
+}
+
+func (s *span) End(err error) {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.Err = err
+	s.mutex.Unlock()
+	if s.exporter != nil && s.data.SpanContext.Sampled {
+		s.exporter.ExportSpan(s.data)
+	}
+}
+
+// InMemoryExporter is a SpanExporter keeping the spans in memory, useful for tests.
+type InMemoryExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter returns a new InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpan keeps the span in memory.
+func (e *InMemoryExporter) ExportSpan(span SpanData) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the exported spans, in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	spans := make([]SpanData, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Reset removes every exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.spans = nil
+}
+
+// noopSpan is the Span used when no Tracer is set.
+type noopSpan struct {
+	spanContext SpanContext
+}
+
+func (s noopSpan) SpanContext() SpanContext {
+	return s.spanContext
+}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+func (noopSpan) End(err error) {}
+
+// startRequestSpan starts the span of the request, continuing the trace of the traceparent header if any,
+// and stores it in the RequestContext.
+func (c *RequestContext) startRequestSpan(tracer Tracer) Span {
+	parent, err := ParseTraceParent(c.GetHeader(HeaderTraceParent))
+	if err == nil {
+		parent.TraceState = c.GetHeader(HeaderTraceState)
+	}
+	if tracer == nil {
+		c.span = noopSpan{spanContext: parent}
+		return c.span
+	}
+	c.tracer = tracer
+	c.span = tracer.StartSpan(parent, c.R.Method+" "+c.RouteURL)
+	c.span.SetAttribute("http.method", c.R.Method)
+	c.span.SetAttribute("http.route", c.RouteURL)
+	c.span.SetAttribute("http.target", c.R.URL.RequestURI())
+	c.R = c.R.WithContext(context.WithValue(c.R.Context(), spanContextKey{}, c.span.SpanContext()))
+	return c.span
+}
+
+// StartSpan starts a span, child of the span of the request, to trace an operation of the handler.
+// It is a no-op if no Tracer has been set with Pi.SetTracer.
+func (c *RequestContext) StartSpan(name string) Span {
+	if c.tracer == nil || c.span == nil {
+		return noopSpan{}
+	}
+	return c.tracer.StartSpan(c.span.SpanContext(), name)
+}
+
+// runSpan runs a phase of the request in a span, ended with the error returned by the phase.
+// If the phase panics, the span is ended with the recovered value before panicking again,
+// so the span is exported even if the request is recovered by a Recoverer.
+func (c *RequestContext) runSpan(name string, phase func() error) error {
+	span := c.StartSpan(name)
+	defer func() {
+		if recoveredValue := recover(); recoveredValue != nil {
+			span.End(fmt.Errorf("panic: %v", recoveredValue))
+			panic(recoveredValue)
+		}
+	}()
+	err := phase()
+	span.End(err)
+	return err
+}
+
+// GetSpanContext returns the SpanContext of the span of the request.
+func (c *RequestContext) GetSpanContext() SpanContext {
+	if c.span == nil {
+		return SpanContext{}
+	}
+	return c.span.SpanContext()
+}
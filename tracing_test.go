@@ -0,0 +1,97 @@
+package pi
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	spanContext, err := ParseTraceParent(traceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !spanContext.Sampled || spanContext.TraceParent() != traceParent {
+		t.Fatalf("unexpected SpanContext %+v", spanContext)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(invalid); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestTracer(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	p := New()
+	p.SetTracer(NewTracer(exporter))
+	p.Router("/",
+		p.Route("/user").Get(func(c *RequestContext) error {
+			return NewError(400, fmt.Errorf("bad request"))
+		}).Before(before1),
+	).Before(before3)
+	p.Construct()
+
+	r := httptest.NewRequest("GET", "/user", nil)
+	r.Header.Set(HeaderTraceParent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	p.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := exporter.Spans()
+	names := []string{"before /", "before /user", "handler", "error", "GET /user"}
+	if len(spans) != len(names) {
+		t.Fatalf("expected %d spans, got %d: %+v", len(names), len(spans), spans)
+	}
+	requestSpan := spans[len(spans)-1]
+	for i, span := range spans {
+		if span.Name != names[i] {
+			t.Errorf("expected span %q, got %q", names[i], span.Name)
+		}
+		if span.SpanContext.TraceID != requestSpan.SpanContext.TraceID {
+			t.Errorf("span %q is not in the trace of the request", span.Name)
+		}
+		if i < len(spans)-1 && span.Parent.SpanID != requestSpan.SpanContext.SpanID {
+			t.Errorf("span %q is not a child of the request span", span.Name)
+		}
+	}
+	if requestSpan.Parent.TraceParent() != r.Header.Get(HeaderTraceParent) {
+		t.Errorf("the request span must continue the trace of the traceparent header")
+	}
+	if requestSpan.Err == nil || requestSpan.Attributes["http.status_code"] != 400 {
+		t.Errorf("unexpected request span %+v", requestSpan)
+	}
+}
+
+func TestTracerPanic(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	p := New()
+	p.SetTracer(NewTracer(exporter))
+	p.Router("/").Get(func(c *RequestContext) error {
+		panic("boom")
+	}).Before(before1).Recover(func(c *RequestContext, recovered interface{}) {
+		c.W.WriteHeader(500)
+	})
+	p.Construct()
+
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	spans := exporter.Spans()
+	names := []string{"before /", "handler", "GET /"}
+	if len(spans) != len(names) {
+		t.Fatalf("expected %d spans, got %d: %+v", len(names), len(spans), spans)
+	}
+	for i, span := range spans {
+		if span.Name != names[i] {
+			t.Errorf("expected span %q, got %q", names[i], span.Name)
+		}
+	}
+	if spans[1].Err == nil || spans[1].Err.Error() != "panic: boom" || spans[2].Err == nil || spans[2].Err.Error() != "panic: boom" {
+		t.Errorf("expected the handler and request spans to end with the panic, got %v and %v", spans[1].Err, spans[2].Err)
+	}
+}
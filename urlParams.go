@@ -0,0 +1,211 @@
+package pi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// urlParamError returns the 400 *BindingError of an URL parameter.
+func urlParamError(param, message string) error {
+	return &BindingError{Fields: []FieldError{{Field: param, Message: message}}}
+}
+
+// lookupURLParam returns the first value of the URL parameter, and whether it is present.
+func (c *RequestContext) lookupURLParam(param string) (string, bool) {
+	values, ok := c.R.URL.Query()[param]
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// getURLParamAs converts the URL parameter into the value pointed by target,
+// returning a 400 *BindingError if it is missing or invalid.
+func (c *RequestContext) getURLParamAs(param string, target interface{}) error {
+	value, ok := c.lookupURLParam(param)
+	if !ok {
+		return urlParamError(param, "is required")
+	}
+	if err := setValue(reflect.ValueOf(target).Elem(), value); err != nil {
+		return urlParamError(param, err.Error())
+	}
+	return nil
+}
+
+// GetURLParamInt returns the URL parameter as an int.
+// It returns a 400 *BindingError if the parameter is missing or is not an integer.
+// For example:
+//		page, err := c.GetURLParamInt("page")
+//		if err != nil {
+//			return err // Output: {"errorCode": 400, "errorMessage": "binding failed", "fields": [{"field":"page","message":"must be an integer"}]}
+//		}
+//
+func (c *RequestContext) GetURLParamInt(param string) (value int, err error) {
+	err = c.getURLParamAs(param, &value)
+	return value, err
+}
+
+// GetURLParamInt64 returns the URL parameter as an int64.
+// It returns a 400 *BindingError if the parameter is missing or is not an integer.
+func (c *RequestContext) GetURLParamInt64(param string) (value int64, err error) {
+	err = c.getURLParamAs(param, &value)
+	return value, err
+}
+
+// GetURLParamBool returns the URL parameter as a bool, see strconv.ParseBool.
+// It returns a 400 *BindingError if the parameter is missing or is not a boolean.
+func (c *RequestContext) GetURLParamBool(param string) (value bool, err error) {
+	err = c.getURLParamAs(param, &value)
+	return value, err
+}
+
+// GetURLParamFloat returns the URL parameter as a float64.
+// It returns a 400 *BindingError if the parameter is missing or is not a number.
+func (c *RequestContext) GetURLParamFloat(param string) (value float64, err error) {
+	err = c.getURLParamAs(param, &value)
+	return value, err
+}
+
+// GetURLParamDuration returns the URL parameter as a time.Duration, see time.ParseDuration.
+// It returns a 400 *BindingError if the parameter is missing or is not a duration.
+func (c *RequestContext) GetURLParamDuration(param string) (value time.Duration, err error) {
+	err = c.getURLParamAs(param, &value)
+	return value, err
+}
+
+// GetURLParamTime returns the URL parameter as a time.Time, parsed with the layout (see time.Parse).
+// It returns a 400 *BindingError if the parameter is missing or does not match the layout.
+func (c *RequestContext) GetURLParamTime(param, layout string) (time.Time, error) {
+	rawValue, ok := c.lookupURLParam(param)
+	if !ok {
+		return time.Time{}, urlParamError(param, "is required")
+	}
+	value, err := time.Parse(layout, rawValue)
+	if err != nil {
+		return time.Time{}, urlParamError(param, "must be a time formatted as "+layout)
+	}
+	return value, nil
+}
+
+// GetURLParamList returns the values of the URL parameter, splitting the comma separated values.
+// For example, given this URL:
+//		/users?id=1,2&id=3
+//
+//		fmt.Println(c.GetURLParamList("id"))
+//		// Outputs [1 2 3]
+//
+func (c *RequestContext) GetURLParamList(param string) []string {
+	var list []string
+	for _, value := range c.R.URL.Query()[param] {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+	}
+	return list
+}
+
+// URLParamsReader reads typed URL parameters, accumulating the conversion errors.
+// For example:
+//		params := c.ReadURLParams()
+//		page := params.Int("page", 1)
+//		since := params.Time("since", time.RFC3339, time.Time{})
+//		if err := params.Err(); err != nil {
+//			return err
+//		}
+//
+type URLParamsReader struct {
+	c      *RequestContext
+	fields []FieldError
+}
+
+// ReadURLParams returns an URLParamsReader reading the URL parameters of the request.
+func (c *RequestContext) ReadURLParams() *URLParamsReader {
+	return &URLParamsReader{c: c}
+}
+
+// read converts the URL parameter into the value pointed by target, recording the conversion error.
+// The target is unchanged if the parameter is missing or invalid.
+func (r *URLParamsReader) read(param string, target interface{}) {
+	if _, ok := r.c.lookupURLParam(param); !ok {
+		return
+	}
+	if err := r.c.getURLParamAs(param, target); err != nil {
+		r.fields = append(r.fields, err.(*BindingError).Fields...)
+	}
+}
+
+// String returns the URL parameter, or defaultValue if it is missing.
+func (r *URLParamsReader) String(param, defaultValue string) string {
+	r.read(param, &defaultValue)
+	return defaultValue
+}
+
+// Int returns the URL parameter as an int, or defaultValue if it is missing or invalid.
+func (r *URLParamsReader) Int(param string, defaultValue int) int {
+	r.read(param, &defaultValue)
+	return defaultValue
+}
+
+// Int64 returns the URL parameter as an int64, or defaultValue if it is missing or invalid.
+func (r *URLParamsReader) Int64(param string, defaultValue int64) int64 {
+	r.read(param, &defaultValue)
+	return defaultValue
+}
+
+// Bool returns the URL parameter as a bool, or defaultValue if it is missing or invalid.
+func (r *URLParamsReader) Bool(param string, defaultValue bool) bool {
+	r.read(param, &defaultValue)
+	return defaultValue
+}
+
+// Float returns the URL parameter as a float64, or defaultValue if it is missing or invalid.
+func (r *URLParamsReader) Float(param string, defaultValue float64) float64 {
+	r.read(param, &defaultValue)
+	return defaultValue
+}
+
+// Duration returns the URL parameter as a time.Duration, or defaultValue if it is missing or invalid.
+func (r *URLParamsReader) Duration(param string, defaultValue time.Duration) time.Duration {
+	r.read(param, &defaultValue)
+	return defaultValue
+}
+
+// Time returns the URL parameter as a time.Time parsed with the layout, or defaultValue if it is missing or invalid.
+func (r *URLParamsReader) Time(param, layout string, defaultValue time.Time) time.Time {
+	if _, ok := r.c.lookupURLParam(param); !ok {
+		return defaultValue
+	}
+	value, err := r.c.GetURLParamTime(param, layout)
+	if err != nil {
+		r.fields = append(r.fields, err.(*BindingError).Fields...)
+		return defaultValue
+	}
+	return value
+}
+
+// List returns the comma separated values of the URL parameter, see RequestContext.GetURLParamList.
+func (r *URLParamsReader) List(param string) []string {
+	return r.c.GetURLParamList(param)
+}
+
+// Required records an error if the URL parameter is missing.
+func (r *URLParamsReader) Required(params ...string) *URLParamsReader {
+	query := r.c.R.URL.Query()
+	for _, param := range params {
+		if _, ok := query[param]; !ok {
+			r.fields = append(r.fields, FieldError{Field: param, Message: "is required"})
+		}
+	}
+	return r
+}
+
+// Err returns a 400 *BindingError listing every URL parameter that could not be read, or nil.
+func (r *URLParamsReader) Err() error {
+	if len(r.fields) == 0 {
+		return nil
+	}
+	return &BindingError{Fields: r.fields}
+}
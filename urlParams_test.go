@@ -0,0 +1,57 @@
+package pi
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetURLParamTyped(t *testing.T) {
+	c := newRequestContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/?page=2&active=yes&ratio=0.5&timeout=2s&ids=1,2&ids=3", nil), "/")
+	if page, err := c.GetURLParamInt("page"); err != nil || page != 2 {
+		t.Errorf("unexpected page %d, %v", page, err)
+	}
+	if _, err := c.GetURLParamBool("active"); err == nil || !strings.Contains(err.Error(), `"must be a boolean"`) {
+		t.Errorf("expected a conversion error, got %v", err)
+	}
+	if ratio, err := c.GetURLParamFloat("ratio"); err != nil || ratio != 0.5 {
+		t.Errorf("unexpected ratio %f, %v", ratio, err)
+	}
+	if timeout, err := c.GetURLParamDuration("timeout"); err != nil || timeout != 2*time.Second {
+		t.Errorf("unexpected timeout %s, %v", timeout, err)
+	}
+	if _, err := c.GetURLParamInt("missing"); err == nil || err.(HTTPError).StatusCode() != 400 {
+		t.Errorf("expected a 400 error for a missing parameter, got %v", err)
+	}
+	if ids := c.GetURLParamList("ids"); !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+		t.Errorf("unexpected ids %v", ids)
+	}
+}
+
+func TestReadURLParams(t *testing.T) {
+	c := newRequestContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/?page=two&limit=10&since=yesterday", nil), "/")
+	params := c.ReadURLParams().Required("q")
+	page := params.Int("page", 1)
+	limit := params.Int("limit", 20)
+	offset := params.Int("offset", 0)
+	since := params.Time("since", time.RFC3339, time.Time{})
+	if page != 1 || limit != 10 || offset != 0 || !since.IsZero() {
+		t.Errorf("unexpected values %d %d %d %s", page, limit, offset, since)
+	}
+	err := params.Err()
+	expected := `{"errorCode": 400, "errorMessage": "binding failed", "fields": [{"field":"q","message":"is required"},{"field":"page","message":"must be an integer"},{"field":"since","message":"must be a time formatted as 2006-01-02T15:04:05Z07:00"}]}`
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestGetURLParamIgnoresPostForm(t *testing.T) {
+	r := httptest.NewRequest("POST", "/?id=1", strings.NewReader("id=2&name=pi"))
+	r.Header.Set("Content-Type", ContentTypeClassicForm)
+	c := newRequestContext(httptest.NewRecorder(), r, "/")
+	if c.GetURLParam("id") != "1" || c.GetURLParam("name") != "" {
+		t.Errorf("expected only the query string to be read, got %q %q", c.GetURLParam("id"), c.GetURLParam("name"))
+	}
+}
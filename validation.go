@@ -0,0 +1,307 @@
+package pi
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrValidation is the message of the ValidationError.
+var ErrValidation = fmt.Errorf("validation failed")
+
+// Validator is implemented by the objects validating themselves.
+// Validate is called by the GetXObject methods after the validation of the struct tags.
+// It may return a ValidationError, an HTTPError, or any other error which is then
+// returned as a ValidationError.
+type Validator interface {
+	Validate() error
+}
+
+// FieldError describes why a field is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is the 422 HTTPError returned by the GetXObject methods when the decoded object is invalid.
+// It is written as JSON, or as XML when the request body is XML, listing the invalid fields:
+//		{"errorCode": 422, "errorMessage": "validation failed", "fields": [{"field": "email", "message": "must be a valid email address"}]}
+//		<error code="422">validation failed<fields><field name="email">must be a valid email address</field></fields></error>
+//
+type ValidationError struct {
+	Fields    []FieldError
+	xml       bool
+	requestID string
+}
+
+// NewValidationError returns a new ValidationError, output as JSON.
+func NewValidationError(fields ...FieldError) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+// NewXMLValidationError returns a new ValidationError, output as XML.
+func NewXMLValidationError(fields ...FieldError) *ValidationError {
+	return &ValidationError{Fields: fields, xml: true}
+}
+
+func (error *ValidationError) Error() string {
+	return formatFieldErrors(error.StatusCode(), ErrValidation.Error(), error.Fields, error.xml, error.requestID)
+}
+
+func (error *ValidationError) StatusCode() int {
+	return 422
+}
+
+func (error *ValidationError) ContentType() string {
+	if error.xml {
+		return "application/xml; charset=UTF-8"
+	}
+	return "application/json; charset=UTF-8"
+}
+
+func (error *ValidationError) withRequestID(requestID string) HTTPError {
+	withRequestID := *error
+	withRequestID.requestID = requestID
+	return &withRequestID
+}
+
+// formatFieldErrors formats the body of the errors listing invalid fields, in JSON or in XML.
+func formatFieldErrors(statusCode int, message string, fields []FieldError, xmlFormat bool, requestID string) string {
+	if xmlFormat {
+		buffer := &bytes.Buffer{}
+		if requestID != "" {
+			fmt.Fprintf(buffer, `<error code="%d" requestId="%s">`, statusCode, escapeXML(requestID))
+		} else {
+			fmt.Fprintf(buffer, `<error code="%d">`, statusCode)
+		}
+		xml.EscapeText(buffer, []byte(message))
+		buffer.WriteString("<fields>")
+		for _, field := range fields {
+			buffer.WriteString(`<field name="`)
+			xml.EscapeText(buffer, []byte(field.Field))
+			buffer.WriteString(`">`)
+			xml.EscapeText(buffer, []byte(field.Message))
+			buffer.WriteString("</field>")
+		}
+		buffer.WriteString("</fields></error>")
+		return buffer.String()
+	}
+	if fields == nil {
+		fields = []FieldError{}
+	}
+	output, _ := json.Marshal(fields)
+	if requestID != "" {
+		return fmt.Sprintf(`{"errorCode": %d, "errorMessage": %s, "fields": %s, "requestId": %s}`, statusCode, strconv.Quote(message), output, strconv.Quote(requestID))
+	}
+	return fmt.Sprintf(`{"errorCode": %d, "errorMessage": %s, "fields": %s}`, statusCode, strconv.Quote(message), output)
+}
+
+// Validate validates the object according to the validate struct tags of its fields, then calls its
+// Validate method if it implements Validator. The field names are taken from the json struct tags.
+// The rules, separated by commas, are:
+//
+//		required	the field must not be the zero value
+//		omitempty	the other rules are skipped when the field is the zero value
+//		min=N		numbers must be greater or equal to N, strings, slices and maps must have at least N elements
+//		max=N		numbers must be lower or equal to N, strings, slices and maps must have at most N elements
+//		len=N		strings, slices and maps must have exactly N elements
+//		email		strings must be email addresses
+//		url			strings must be absolute URLs
+//		oneof=a b	strings and numbers must be one of the values separated by spaces
+//
+// Like email and url, oneof accepts the zero values, the empty string and 0, so required must be
+// added to reject them.
+//
+// Nested structs and slices of structs are validated too. For example:
+//		type User struct {
+//			Name  string   `json:"name" validate:"required,max=64"`
+//			Email string   `json:"email" validate:"required,email"`
+//			Roles []string `json:"roles" validate:"min=1"`
+//		}
+//
+func Validate(object interface{}) error {
+	return validate(object, "json", false)
+}
+
+// validate validates the object, naming the fields according to the struct tag,
+// returning the ValidationError in XML if xmlFormat is true.
+func validate(object interface{}, tagName string, xmlFormat bool) error {
+	var fields []FieldError
+	validateValue(reflect.ValueOf(object), "", tagName, &fields)
+	if validator, ok := object.(Validator); ok && len(fields) == 0 {
+		if err := validator.Validate(); err != nil {
+			switch err := err.(type) {
+			case *ValidationError:
+				fields = append(fields, err.Fields...)
+			case HTTPError:
+				return err
+			default:
+				fields = append(fields, FieldError{Message: err.Error()})
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields, xml: xmlFormat}
+}
+
+// validateValue validates the fields of a struct, or the elements of a slice, recursively.
+func validateValue(value reflect.Value, path, tagName string, fields *[]FieldError) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i), tagName, fields)
+		}
+	case reflect.Struct:
+		valueType := value.Type()
+		for i := 0; i < valueType.NumField(); i++ {
+			structField := valueType.Field(i)
+			if structField.PkgPath != "" {
+				continue
+			}
+			rules := structField.Tag.Get("validate")
+			if rules == "-" {
+				continue
+			}
+			fieldPath := fieldName(structField, tagName)
+			if structField.Anonymous && structField.Tag.Get(tagName) == "" {
+				fieldPath = path
+			} else if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			fieldValue := value.Field(i)
+			if rules != "" {
+				if message := validateRules(fieldValue, rules); message != "" {
+					*fields = append(*fields, FieldError{Field: fieldPath, Message: message})
+					continue
+				}
+			}
+			validateValue(fieldValue, fieldPath, tagName, fields)
+		}
+	}
+}
+
+// fieldName returns the name of the field according to the struct tag, or to the Bind struct tags,
+// or the name of the field.
+func fieldName(structField reflect.StructField, tagName string) string {
+	for _, tag := range []string{tagName, "path", "query", "header"} {
+		if name := strings.Split(structField.Tag.Get(tag), ",")[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+	return structField.Name
+}
+
+// validateRules checks the rules of a field, returning the message of the first rule failing,
+// or an empty string.
+func validateRules(value reflect.Value, rules string) string {
+	isZero := value.IsZero()
+	if strings.Contains(","+rules+",", ",omitempty,") && isZero {
+		return ""
+	}
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			break
+		}
+		value = value.Elem()
+	}
+	for _, rule := range strings.Split(rules, ",") {
+		name, parameter := rule, ""
+		if index := strings.Index(rule, "="); index >= 0 {
+			name, parameter = rule[:index], rule[index+1:]
+		}
+		switch name {
+		case "required":
+			if isZero {
+				return "is required"
+			}
+		case "min", "max", "len":
+			if message := validateSize(value, name, parameter); message != "" {
+				return message
+			}
+		case "email":
+			if value.Kind() == reflect.String && value.String() != "" {
+				if address, err := mail.ParseAddress(value.String()); err != nil || address.Address != value.String() {
+					return "must be a valid email address"
+				}
+			}
+		case "url":
+			if value.Kind() == reflect.String && value.String() != "" {
+				if u, err := url.Parse(value.String()); err != nil || u.Scheme == "" || u.Host == "" {
+					return "must be a valid URL"
+				}
+			}
+		case "oneof":
+			if !isZero {
+				formatted := fmt.Sprintf("%v", value.Interface())
+				if !containsString(strings.Fields(parameter), formatted) {
+					return "must be one of: " + strings.Join(strings.Fields(parameter), ", ")
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// validateSize checks the min, max and len rules.
+func validateSize(value reflect.Value, rule, parameter string) string {
+	limit, err := strconv.ParseFloat(parameter, 64)
+	if err != nil {
+		return fmt.Sprintf("has an invalid %s rule", rule)
+	}
+	var size float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = value.Float()
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(value.Len()), " elements"
+	default:
+		return ""
+	}
+	switch {
+	case rule == "min" && size < limit:
+		if unit != "" {
+			return fmt.Sprintf("must have at least %s%s", parameter, unit)
+		}
+		return fmt.Sprintf("must be greater or equal to %s", parameter)
+	case rule == "max" && size > limit:
+		if unit != "" {
+			return fmt.Sprintf("must have at most %s%s", parameter, unit)
+		}
+		return fmt.Sprintf("must be lower or equal to %s", parameter)
+	case rule == "len" && size != limit:
+		return fmt.Sprintf("must have exactly %s%s", parameter, unit)
+	}
+	return ""
+}
+
+// containsString checks if the values contains the value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
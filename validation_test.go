@@ -0,0 +1,125 @@
+package pi
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type validatedAddress struct {
+	City string `json:"city" validate:"required"`
+}
+
+type validatedUser struct {
+	Name      string             `json:"name" xml:"name" validate:"required,max=8"`
+	Email     string             `json:"email" xml:"email" validate:"omitempty,email"`
+	Age       int                `json:"age" xml:"age" validate:"min=18"`
+	Role      string             `json:"role" xml:"role" validate:"oneof=admin user"`
+	Tags      []string           `json:"tags" xml:"tags" validate:"max=2"`
+	Website   string             `json:"website" xml:"website" validate:"omitempty,url"`
+	Addresses []validatedAddress `json:"addresses" xml:"addresses"`
+}
+
+func (u *validatedUser) Validate() error {
+	if u.Name == "root" {
+		return fmt.Errorf("root is reserved")
+	}
+	return nil
+}
+
+func TestValidateOneOfZeroValues(t *testing.T) {
+	type choices struct {
+		Text     string `json:"text" validate:"oneof=a b"`
+		Number   int    `json:"number" validate:"oneof=1 2"`
+		Required string `json:"required" validate:"required,oneof=a b"`
+	}
+	err := Validate(&choices{})
+	validationError, ok := err.(*ValidationError)
+	if !ok || len(validationError.Fields) != 1 || validationError.Fields[0] != (FieldError{"required", "is required"}) {
+		t.Errorf("expected only the required field to be invalid, got %v", err)
+	}
+	if err := Validate(&choices{Text: "c", Number: 3, Required: "a"}); err == nil || len(err.(*ValidationError).Fields) != 2 {
+		t.Errorf("expected text and number to be invalid, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := validatedUser{Name: "pi", Email: "pi@example.com", Age: 18, Role: "admin", Website: "https://example.com"}
+	if err := Validate(&valid); err != nil {
+		t.Fatalf("expected the user to be valid, got %v", err)
+	}
+
+	invalid := validatedUser{
+		Name:      "too long name",
+		Email:     "pi",
+		Age:       12,
+		Role:      "owner",
+		Tags:      []string{"a", "b", "c"},
+		Website:   "example.com",
+		Addresses: []validatedAddress{{City: "Paris"}, {}},
+	}
+	err := Validate(&invalid)
+	validationError, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	expected := []FieldError{
+		{"name", "must have at most 8 characters"},
+		{"email", "must be a valid email address"},
+		{"age", "must be greater or equal to 18"},
+		{"role", "must be one of: admin, user"},
+		{"tags", "must have at most 2 elements"},
+		{"website", "must be a valid URL"},
+		{"addresses[1].city", "is required"},
+	}
+	if len(validationError.Fields) != len(expected) {
+		t.Fatalf("expected %d field errors, got %+v", len(expected), validationError.Fields)
+	}
+	for i, field := range validationError.Fields {
+		if field != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], field)
+		}
+	}
+
+	root := valid
+	root.Name = "root"
+	if err := Validate(&root); err == nil || !strings.Contains(err.Error(), "root is reserved") {
+		t.Errorf("expected the Validator to be called, got %v", err)
+	}
+}
+
+func TestGetDefaultObjectValidates(t *testing.T) {
+	p := New()
+	p.Router("/").Post(func(c *RequestContext) error {
+		user := &validatedUser{}
+		if err := c.GetDefaultObject(user); err != nil {
+			return err
+		}
+		return c.WriteString(user.Name)
+	})
+	p.Construct()
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"age": 20, "role": "user"}`))
+	r.Header.Set("Content-Type", ContentTypeJSON)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != 422 || w.Body.String() != `{"errorCode": 422, "errorMessage": "validation failed", "fields": [{"field":"name","message":"is required"}]}` {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`<user><age>20</age><role>user</role></user>`))
+	r.Header.Set("Content-Type", ContentTypeXML)
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	if w.Code != 422 || w.Body.String() != `<error code="422">validation failed<fields><field name="name">is required</field></fields></error>` {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestValidationErrorEscapesRequestID(t *testing.T) {
+	err := NewXMLValidationError(FieldError{"name", "is required"}).withRequestID(`a"<b>`)
+	if expected := `<error code="422" requestId="a&#34;&lt;b&gt;">validation failed<fields><field name="name">is required</field></fields></error>`; err.Error() != expected {
+		t.Errorf("expected %s, got %s", expected, err.Error())
+	}
+}
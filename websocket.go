@@ -0,0 +1,588 @@
+package pi
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The message types of the WebSocket frames, see RFC 6455 section 5.2.
+const (
+	WebSocketContinuationMessage = 0
+	WebSocketTextMessage         = 1
+	WebSocketBinaryMessage       = 2
+	WebSocketCloseMessage        = 8
+	WebSocketPingMessage         = 9
+	WebSocketPongMessage         = 10
+)
+
+// The close codes of the WebSocket connections, see RFC 6455 section 7.4.1.
+const (
+	WebSocketCloseNormal          = 1000
+	WebSocketCloseGoingAway       = 1001
+	WebSocketCloseProtocolError   = 1002
+	WebSocketCloseUnsupportedData = 1003
+	WebSocketCloseNoStatus        = 1005
+	WebSocketCloseAbnormal        = 1006
+	WebSocketCloseInvalidPayload  = 1007
+	WebSocketClosePolicyViolation = 1008
+	WebSocketCloseMessageTooBig   = 1009
+	WebSocketCloseInternalError   = 1011
+	WebSocketCloseTLSHandshake    = 1015
+)
+
+// webSocketGUID is the GUID concatenated to the key of the handshake, see RFC 6455 section 1.3.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// DefaultWebSocketReadLimit is the default maximum size of a message read from a WebSocket connection.
+	DefaultWebSocketReadLimit int64 = 1 << 20
+
+	// ErrWebSocketUpgrade is the error when a request routed to a WebSocket handler is not a WebSocket handshake.
+	ErrWebSocketUpgrade = fmt.Errorf("not a websocket handshake")
+
+	// ErrWebSocketVersion is the error when the WebSocket version requested by the client is not supported.
+	ErrWebSocketVersion = fmt.Errorf("websocket version not supported")
+
+	// ErrWebSocketOrigin is the error when the origin of a WebSocket handshake is not allowed.
+	ErrWebSocketOrigin = fmt.Errorf("websocket origin not allowed")
+
+	// ErrWebSocketHandshake is the error when the server rejects the handshake of DialWebSocket.
+	ErrWebSocketHandshake = fmt.Errorf("websocket handshake failed")
+
+	// ErrWebSocketClosed is the error when writing to a WebSocket connection once the close message has been sent.
+	ErrWebSocketClosed = fmt.Errorf("websocket connection closed")
+
+	// ErrWebSocketMessageTooBig is the error when a message read is larger than the read limit.
+	ErrWebSocketMessageTooBig = fmt.Errorf("websocket message too big")
+
+	// ErrWebSocketProtocol is the error when the peer does not follow RFC 6455.
+	ErrWebSocketProtocol = fmt.Errorf("websocket protocol error")
+)
+
+// WebSocketHandler is the type of the handlers of the WebSocket routes.
+// The connection is closed once the handler returns, with a 1011 internal error close code if it returns an error.
+type WebSocketHandler func(c *RequestContext, conn *WebSocketConn) error
+
+// WebSocketOptions configures the WebSocket handshake, see RequestContext.UpgradeWebSocket.
+type WebSocketOptions struct {
+	// AllowedOrigins are the origins allowed to open a connection, where "*" matches any sequence of characters.
+	// If empty, only the requests without Origin or from the same host are allowed.
+	AllowedOrigins []string
+
+	// Subprotocols are the subprotocols supported by the server, in order of preference.
+	Subprotocols []string
+
+	// ReadLimit is the maximum size of a message read, DefaultWebSocketReadLimit if lower or equal to 0.
+	ReadLimit int64
+}
+
+// WebSocketCloseError is the error returned by ReadMessage once the peer has closed the connection.
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (error *WebSocketCloseError) Error() string {
+	if error.Reason == "" {
+		return fmt.Sprintf("websocket closed with code %d", error.Code)
+	}
+	return fmt.Sprintf("websocket closed with code %d: %s", error.Code, error.Reason)
+}
+
+// WebSocket registers a WebSocketHandler to handle GET requests with the WebSocket protocol.
+// The Before interceptors run before the handshake, so they can reject the request, for example to authenticate it.
+// The handshake only allows the requests from the same origin, see WebSocketWithOptions for other options.
+// For example:
+//		p.Router("/chat").Before(authenticate).WebSocket(func(c *pi.RequestContext, conn *pi.WebSocketConn) error {
+//			for {
+//				messageType, message, err := conn.ReadMessage()
+//				if err != nil {
+//					return nil
+//				}
+//				if err := conn.WriteMessage(messageType, message); err != nil {
+//					return err
+//				}
+//			}
+//		})
+//
+func (r *Route) WebSocket(handler WebSocketHandler) *Route {
+	return r.WebSocketWithOptions(handler, nil)
+}
+
+// WebSocketWithOptions works like WebSocket, performing the handshake with the given options,
+// see RequestContext.UpgradeWebSocket. If options is nil, the default options are used.
+// For example:
+//		p.Router("/chat").WebSocketWithOptions(chat, &pi.WebSocketOptions{
+//			AllowedOrigins: []string{"https://*.example.com"},
+//			Subprotocols:   []string{"chat.v2", "chat.v1"},
+//		})
+//
+func (r *Route) WebSocketWithOptions(handler WebSocketHandler, options *WebSocketOptions) *Route {
+	return r.Get(webSocketHandler(handler, options))
+}
+
+// webSocketHandler returns the HandlerFunction performing the handshake and calling the WebSocketHandler.
+func webSocketHandler(handler WebSocketHandler, options *WebSocketOptions) HandlerFunction {
+	return func(c *RequestContext) error {
+		conn, err := c.UpgradeWebSocket(options)
+		if err != nil {
+			return err
+		}
+		if err := handler(c, conn); err != nil {
+			conn.Close(WebSocketCloseInternalError, "")
+			return err
+		}
+		return conn.Close(WebSocketCloseNormal, "")
+	}
+}
+
+// UpgradeWebSocket performs the WebSocket handshake of RFC 6455 and returns the connection, which must be closed.
+// It returns a 400 HTTPError if the request is not a handshake, a 426 if the version is not supported
+// and a 403 if the origin is not allowed. If options is nil, the default options are used.
+func (c *RequestContext) UpgradeWebSocket(options *WebSocketOptions) (*WebSocketConn, error) {
+	if options == nil {
+		options = &WebSocketOptions{}
+	}
+	if c.R.Method != "GET" || !containsFold(splitHeaderValues(c.GetHeader("Connection")), "upgrade") ||
+		!containsFold(splitHeaderValues(c.GetHeader("Upgrade")), "websocket") {
+		return nil, NewError(http.StatusBadRequest, ErrWebSocketUpgrade, ErrorHeader("Upgrade", "websocket"))
+	}
+	if c.GetHeader("Sec-WebSocket-Version") != "13" {
+		return nil, NewError(http.StatusUpgradeRequired, ErrWebSocketVersion, ErrorHeader("Sec-WebSocket-Version", "13"))
+	}
+	key := c.GetHeader("Sec-WebSocket-Key")
+	if decodedKey, err := base64.StdEncoding.DecodeString(key); err != nil || len(decodedKey) != 16 {
+		return nil, NewError(http.StatusBadRequest, ErrWebSocketUpgrade)
+	}
+	if !options.allowsOrigin(c.R) {
+		return nil, NewError(http.StatusForbidden, ErrWebSocketOrigin)
+	}
+	subprotocol := ""
+	for _, supported := range options.Subprotocols {
+		if containsFold(splitHeaderValues(c.GetHeader("Sec-WebSocket-Protocol")), supported) {
+			subprotocol = supported
+			break
+		}
+	}
+
+	hijacker, ok := c.W.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("the ResponseWriter does not implement http.Hijacker")
+	}
+	header := c.W.Header().Clone()
+	netConn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The deadlines of the server are not reset by Hijack.
+	netConn.SetDeadline(time.Time{})
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", webSocketAccept(key))
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	buffer.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(buffer)
+	buffer.WriteString("\r\n")
+	if err := buffer.Flush(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	conn := newWebSocketConn(netConn, buffer.Reader, false, subprotocol)
+	conn.SetReadLimit(options.ReadLimit)
+	return conn, nil
+}
+
+// allowsOrigin checks if the origin of the handshake is allowed.
+func (options *WebSocketOptions) allowsOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(options.AllowedOrigins) == 0 {
+		originURL, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(originURL.Host, r.Host)
+	}
+	for _, pattern := range options.AllowedOrigins {
+		if matchWildcard(strings.ToLower(pattern), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+// webSocketAccept returns the value of the Sec-WebSocket-Accept header for the key of the handshake.
+func webSocketAccept(key string) string {
+	hash := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// DialWebSocket opens a WebSocket connection to a ws:// or wss:// URL, sending the header with the handshake.
+// If the server rejects the handshake, the response is returned with ErrWebSocketHandshake.
+// It is mainly useful to test the WebSocket routes.
+// For example:
+//		server := httptest.NewServer(p)
+//		conn, _, err := pi.DialWebSocket("ws"+strings.TrimPrefix(server.URL, "http")+"/chat", nil)
+//
+func DialWebSocket(rawURL string, header http.Header) (*WebSocketConn, *http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	var netConn net.Conn
+	switch u.Scheme {
+	case "ws":
+		netConn, err = net.Dial("tcp", hostWithPort(u, "80"))
+	case "wss":
+		netConn, err = tls.Dial("tcp", hostWithPort(u, "443"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, nil, fmt.Errorf("unsupported websocket scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	request := &http.Request{Method: "GET", URL: u, Host: u.Host, Header: make(http.Header)}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	if err := request.Write(netConn); err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(netConn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		netConn.Close()
+		return nil, nil, err
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		netConn.Close()
+		return nil, response, ErrWebSocketHandshake
+	}
+	return newWebSocketConn(netConn, reader, true, response.Header.Get("Sec-WebSocket-Protocol")), response, nil
+}
+
+// hostWithPort returns the host of the URL with its port, or the default port.
+func hostWithPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+// WebSocketConn is a message oriented WebSocket connection, see Route.WebSocket.
+// A message can be read and another written concurrently, the pings received are answered automatically.
+type WebSocketConn struct {
+	conn        net.Conn
+	reader      *bufio.Reader
+	client      bool
+	subprotocol string
+	readLimit   int64
+	pongHandler func(data []byte)
+	closeErr    *WebSocketCloseError
+
+	writeMutex sync.Mutex
+	closeSent  bool
+}
+
+// newWebSocketConn returns a new WebSocketConn, masking the frames written if it is a client.
+func newWebSocketConn(conn net.Conn, reader *bufio.Reader, client bool, subprotocol string) *WebSocketConn {
+	return &WebSocketConn{
+		conn:        conn,
+		reader:      reader,
+		client:      client,
+		subprotocol: subprotocol,
+		readLimit:   DefaultWebSocketReadLimit,
+	}
+}
+
+// Subprotocol returns the subprotocol negotiated during the handshake, if any.
+func (conn *WebSocketConn) Subprotocol() string {
+	return conn.subprotocol
+}
+
+// SetReadLimit sets the maximum size of a message read. When a larger message is received,
+// the connection is closed with a 1009 close code and ReadMessage returns ErrWebSocketMessageTooBig.
+// The size of the messages is always limited: DefaultWebSocketReadLimit is used if limit is lower or equal to 0.
+func (conn *WebSocketConn) SetReadLimit(limit int64) {
+	if limit <= 0 {
+		limit = DefaultWebSocketReadLimit
+	}
+	conn.readLimit = limit
+}
+
+// SetPongHandler sets the function called by ReadMessage when a pong is received.
+func (conn *WebSocketConn) SetPongHandler(handler func(data []byte)) {
+	conn.pongHandler = handler
+}
+
+// SetReadDeadline sets the deadline of the reads of the underlying connection.
+func (conn *WebSocketConn) SetReadDeadline(deadline time.Time) error {
+	return conn.conn.SetReadDeadline(deadline)
+}
+
+// SetWriteDeadline sets the deadline of the writes of the underlying connection.
+func (conn *WebSocketConn) SetWriteDeadline(deadline time.Time) error {
+	return conn.conn.SetWriteDeadline(deadline)
+}
+
+// ReadMessage reads the next text or binary message, answering the pings and calling the pong handler meanwhile.
+// Once the peer has closed the connection, the close message is answered and a *WebSocketCloseError is returned.
+func (conn *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	if conn.closeErr != nil {
+		return 0, nil, conn.closeErr
+	}
+	for {
+		fin, opcode, payload, err := conn.readFrame(int64(len(data)))
+		if err != nil {
+			return 0, nil, conn.fail(err)
+		}
+		switch opcode {
+		case WebSocketPingMessage:
+			if err := conn.writeFrame(WebSocketPongMessage, payload); err != nil && err != ErrWebSocketClosed {
+				return 0, nil, err
+			}
+			continue
+		case WebSocketPongMessage:
+			if conn.pongHandler != nil {
+				conn.pongHandler(payload)
+			}
+			continue
+		case WebSocketCloseMessage:
+			return 0, nil, conn.receiveClose(payload)
+		case WebSocketTextMessage, WebSocketBinaryMessage:
+			if messageType != 0 {
+				return 0, nil, conn.fail(ErrWebSocketProtocol)
+			}
+			messageType = opcode
+		case WebSocketContinuationMessage:
+			if messageType == 0 {
+				return 0, nil, conn.fail(ErrWebSocketProtocol)
+			}
+		default:
+			return 0, nil, conn.fail(ErrWebSocketProtocol)
+		}
+		data = append(data, payload...)
+		if fin {
+			if messageType == WebSocketTextMessage && !utf8.Valid(data) {
+				conn.Close(WebSocketCloseInvalidPayload, "")
+				return 0, nil, ErrWebSocketProtocol
+			}
+			return messageType, data, nil
+		}
+	}
+}
+
+// readFrame reads a frame, checking the read limit of the data frames against the size already read.
+func (conn *WebSocketConn) readFrame(read int64) (fin bool, opcode int, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, int(header[0]&0x0f)
+	masked, length := header[1]&0x80 != 0, int64(header[1]&0x7f)
+	if header[0]&0x70 != 0 || masked == conn.client {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(conn.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(conn.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+		if length = int64(binary.BigEndian.Uint64(extended[:])); length < 0 {
+			return false, 0, nil, ErrWebSocketProtocol
+		}
+	}
+	if opcode >= WebSocketCloseMessage && (!fin || length > 125) {
+		return false, 0, nil, ErrWebSocketProtocol
+	}
+	if opcode < WebSocketCloseMessage && length > conn.readLimit-read {
+		return false, 0, nil, ErrWebSocketMessageTooBig
+	}
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(conn.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(conn.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, opcode, payload, nil
+}
+
+// fail closes the connection with the close code matching the error.
+func (conn *WebSocketConn) fail(err error) error {
+	switch err {
+	case ErrWebSocketProtocol:
+		conn.Close(WebSocketCloseProtocolError, "")
+	case ErrWebSocketMessageTooBig:
+		conn.Close(WebSocketCloseMessageTooBig, "")
+	}
+	return err
+}
+
+// receiveClose answers the close message of the peer and returns the matching *WebSocketCloseError.
+// The close messages with a code which cannot be sent, such as 1005, are failed with a 1002 protocol error,
+// the ones with a reason which is not UTF-8 with a 1007 invalid payload error, see RFC 6455 section 7.4.
+func (conn *WebSocketConn) receiveClose(payload []byte) error {
+	closeErr := &WebSocketCloseError{Code: WebSocketCloseNoStatus}
+	if len(payload) == 1 {
+		return conn.fail(ErrWebSocketProtocol)
+	}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return conn.fail(ErrWebSocketProtocol)
+		}
+		if !utf8.ValidString(closeErr.Reason) {
+			conn.Close(WebSocketCloseInvalidPayload, "")
+			return ErrWebSocketProtocol
+		}
+	}
+	conn.closeErr = closeErr
+	conn.writeClose(closeErr.Code, "")
+	return closeErr
+}
+
+// validCloseCode checks if the close code can be received: the codes defined by RFC 6455 and registered
+// by the IANA, except 1004 which is reserved and the ones reporting a closure without close message
+// (1005, 1006 and 1015), and the codes of the libraries and applications, from 3000 to 4999.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// WriteMessage writes a text or binary message in a single frame.
+func (conn *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != WebSocketTextMessage && messageType != WebSocketBinaryMessage {
+		return fmt.Errorf("websocket message type %d cannot be written with WriteMessage", messageType)
+	}
+	return conn.writeFrame(messageType, data)
+}
+
+// Ping sends a ping, the peer answering with a pong, see SetPongHandler.
+func (conn *WebSocketConn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return ErrWebSocketMessageTooBig
+	}
+	return conn.writeFrame(WebSocketPingMessage, data)
+}
+
+// Close sends a close message with the code and the reason, if not already sent, then closes the connection.
+// The reason is truncated to fit in a control frame, without splitting a UTF-8 character.
+func (conn *WebSocketConn) Close(code int, reason string) error {
+	err := conn.writeClose(code, reason)
+	if closeErr := conn.conn.Close(); err == nil || err == ErrWebSocketClosed {
+		err = closeErr
+	}
+	return err
+}
+
+// writeClose sends a close message, if not already sent.
+func (conn *WebSocketConn) writeClose(code int, reason string) error {
+	var payload []byte
+	if code != WebSocketCloseNoStatus && code != WebSocketCloseAbnormal && code != WebSocketCloseTLSHandshake {
+		if len(reason) > 123 {
+			end := 123
+			for end > 0 && !utf8.RuneStart(reason[end]) {
+				end--
+			}
+			reason = reason[:end]
+		}
+		payload = make([]byte, 2, 2+len(reason))
+		binary.BigEndian.PutUint16(payload, uint16(code))
+		payload = append(payload, reason...)
+	}
+	return conn.writeFrame(WebSocketCloseMessage, payload)
+}
+
+// writeFrame writes a frame, masked if the connection is a client.
+// Nothing can be written once the close message has been sent.
+func (conn *WebSocketConn) writeFrame(opcode int, payload []byte) error {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	if conn.closeSent {
+		return ErrWebSocketClosed
+	}
+	if opcode == WebSocketCloseMessage {
+		conn.closeSent = true
+	}
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|byte(opcode))
+	maskBit := byte(0)
+	if conn.client {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	if conn.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+	_, err := conn.conn.Write(frame)
+	return err
+}
+
+// maskBytes masks or unmasks the data with the key, see RFC 6455 section 5.3.
+func maskBytes(key [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= key[i%4]
+	}
+}
@@ -0,0 +1,221 @@
+package pi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newWebSocketTestServer() *httptest.Server {
+	p := New()
+	p.Router("/echo").Before(func(c *RequestContext) error {
+		if c.GetURLParam("token") != "secret" {
+			return NewUnauthorizedError("Bearer", fmt.Errorf("invalid token"))
+		}
+		return nil
+	}).WebSocket(func(c *RequestContext, conn *WebSocketConn) error {
+		conn.SetReadLimit(1024)
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return nil
+			}
+			if string(message) == "fail" {
+				return fmt.Errorf("failure")
+			}
+			if err := conn.WriteMessage(messageType, message); err != nil {
+				return err
+			}
+		}
+	})
+	p.Router("/subprotocol").WebSocketWithOptions(func(c *RequestContext, conn *WebSocketConn) error {
+		return conn.WriteMessage(WebSocketTextMessage, []byte(conn.Subprotocol()))
+	}, &WebSocketOptions{AllowedOrigins: []string{"http://*.example.com"}, Subprotocols: []string{"chat.v2", "chat.v1"}})
+	p.Construct()
+	return httptest.NewServer(p)
+}
+
+func TestWebSocket(t *testing.T) {
+	server := newWebSocketTestServer()
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/echo?token=secret"
+
+	conn, _, err := DialWebSocket(wsURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pongs := make(chan string, 1)
+	conn.SetPongHandler(func(data []byte) { pongs <- string(data) })
+	if err := conn.Ping([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	messages := []struct {
+		messageType int
+		data        string
+	}{
+		{WebSocketTextMessage, "hello"},
+		{WebSocketBinaryMessage, strings.Repeat("b", 1000)},
+	}
+	for _, message := range messages {
+		if err := conn.WriteMessage(message.messageType, []byte(message.data)); err != nil {
+			t.Fatal(err)
+		}
+		messageType, data, err := conn.ReadMessage()
+		if err != nil || messageType != message.messageType || string(data) != message.data {
+			t.Errorf("expected the message %d %q to be echoed, got %d %q %v", message.messageType, message.data, messageType, data, err)
+		}
+	}
+	if pong := <-pongs; pong != "ping" {
+		t.Errorf("expected the pong ping, got %q", pong)
+	}
+	if err := conn.Close(WebSocketCloseGoingAway, "bye"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebSocketCloseCodes(t *testing.T) {
+	server := newWebSocketTestServer()
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/echo?token=secret"
+
+	tests := map[string]int{
+		"fail":                    WebSocketCloseInternalError,
+		strings.Repeat("a", 2000): WebSocketCloseMessageTooBig,
+	}
+	for message, code := range tests {
+		conn, _, err := DialWebSocket(wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.WriteMessage(WebSocketTextMessage, []byte(message))
+		_, _, err = conn.ReadMessage()
+		if closeErr, ok := err.(*WebSocketCloseError); !ok || closeErr.Code != code {
+			t.Errorf("expected the close code %d, got %v", code, err)
+		}
+		conn.Close(WebSocketCloseNormal, "")
+	}
+}
+
+func TestWebSocketHandshakeErrors(t *testing.T) {
+	server := newWebSocketTestServer()
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/echo"
+
+	tests := []struct {
+		url    string
+		header http.Header
+		code   int
+	}{
+		{wsURL, nil, 401},
+		{wsURL + "?token=secret", http.Header{"Origin": {"http://evil.example.com"}}, 403},
+	}
+	for _, test := range tests {
+		_, response, err := DialWebSocket(test.url, test.header)
+		if err != ErrWebSocketHandshake || response == nil || response.StatusCode != test.code {
+			t.Errorf("expected a %d handshake error, got %v %v", test.code, response, err)
+		}
+	}
+	response, err := http.Get(server.URL + "/echo?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != 400 {
+		t.Errorf("expected 400 for a plain GET, got %d", response.StatusCode)
+	}
+}
+
+func TestWebSocketWithOptions(t *testing.T) {
+	server := newWebSocketTestServer()
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/subprotocol"
+
+	conn, _, err := DialWebSocket(wsURL, http.Header{"Origin": {"http://www.example.com"}, "Sec-WebSocket-Protocol": {"chat.v1, chat.v2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(WebSocketCloseNormal, "")
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "chat.v2" || conn.Subprotocol() != "chat.v2" {
+		t.Errorf("expected the subprotocol chat.v2, got %q %q %v", data, conn.Subprotocol(), err)
+	}
+
+	_, response, err := DialWebSocket(wsURL, http.Header{"Origin": {"http://evil.com"}})
+	if err != ErrWebSocketHandshake || response == nil || response.StatusCode != 403 {
+		t.Errorf("expected a 403 handshake error, got %v %v", response, err)
+	}
+}
+
+func TestWebSocketInvalidCloseMessages(t *testing.T) {
+	server := newWebSocketTestServer()
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/echo?token=secret"
+
+	tests := []struct {
+		payload []byte
+		code    int
+	}{
+		{[]byte{0x03, 0xe8}, WebSocketCloseNormal},
+		{append([]byte{0x0f, 0xa0}, "bye"...), 4000},
+		{[]byte{0x03, 0xed}, WebSocketCloseProtocolError},
+		{[]byte{0x03, 0xee}, WebSocketCloseProtocolError},
+		{[]byte{0x03, 0xf7}, WebSocketCloseProtocolError},
+		{[]byte{0x03, 0xe7}, WebSocketCloseProtocolError},
+		{[]byte{0x13, 0x88}, WebSocketCloseProtocolError},
+		{append([]byte{0x03, 0xe8}, 0xff, 0xfe), WebSocketCloseInvalidPayload},
+	}
+	for _, test := range tests {
+		conn, _, err := DialWebSocket(wsURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.writeFrame(WebSocketCloseMessage, test.payload); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = conn.ReadMessage()
+		if closeErr, ok := err.(*WebSocketCloseError); !ok || closeErr.Code != test.code {
+			t.Errorf("expected the close code %d for %v, got %v", test.code, test.payload, err)
+		}
+		conn.Close(WebSocketCloseNormal, "")
+	}
+}
+
+func newWebSocketPipe() (server, client *WebSocketConn) {
+	serverConn, clientConn := net.Pipe()
+	return newWebSocketConn(serverConn, bufio.NewReader(serverConn), false, ""), newWebSocketConn(clientConn, bufio.NewReader(clientConn), true, "")
+}
+
+func TestWebSocketReadLimit(t *testing.T) {
+	server, client := newWebSocketPipe()
+	defer client.Close(WebSocketCloseNormal, "")
+	server.SetReadLimit(0)
+	if server.readLimit != DefaultWebSocketReadLimit {
+		t.Errorf("expected the default read limit, got %d", server.readLimit)
+	}
+	go func() {
+		// A binary frame announcing the largest 64 bit length, masked as sent by a client.
+		client.conn.Write([]byte{0x82, 0x80 | 127, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+		io.Copy(io.Discard, client.conn)
+	}()
+	if _, _, err := server.ReadMessage(); err != ErrWebSocketMessageTooBig {
+		t.Errorf("expected ErrWebSocketMessageTooBig, got %v", err)
+	}
+}
+
+func TestWebSocketCloseReasonTruncation(t *testing.T) {
+	server, client := newWebSocketPipe()
+	defer client.Close(WebSocketCloseNormal, "")
+	reason := strings.Repeat("a", 122) + "é"
+	go func() {
+		server.writeClose(WebSocketCloseGoingAway, reason)
+		io.Copy(io.Discard, server.conn)
+	}()
+	_, _, err := client.ReadMessage()
+	if closeErr, ok := err.(*WebSocketCloseError); !ok || closeErr.Code != WebSocketCloseGoingAway || closeErr.Reason != strings.Repeat("a", 122) {
+		t.Errorf("expected the reason to be truncated before the last character, got %v", err)
+	}
+}